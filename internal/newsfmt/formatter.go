@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html"
 	"strings"
+	"unicode/utf8"
 )
 
 type Formatter struct {
@@ -16,13 +17,23 @@ func NewFormatter(maxTextRunes int) *Formatter {
 
 func (f *Formatter) HitMessage(h HitView) string {
 	kw := strings.TrimSpace(h.Keyword)
+	kwLabel := "keyword"
+	if len(h.Keywords) > 1 {
+		kw = strings.Join(h.Keywords, ", ")
+		kwLabel = "keywords"
+	}
 
 	reason := strings.TrimSpace(h.Reason)
 	if reason == "" {
 		reason = "—"
 	}
 
-	txt := truncateRunes(strings.TrimSpace(h.Text), f.maxTextRunes)
+	var txtEsc string
+	if txtHTML := strings.TrimSpace(h.TextHTML); txtHTML != "" {
+		txtEsc = truncateHTML(txtHTML, f.maxTextRunes)
+	} else {
+		txtEsc = html.EscapeString(truncateRunes(strings.TrimSpace(h.Text), f.maxTextRunes))
+	}
 	link := strings.TrimSpace(h.Link)
 
 	tag := ""
@@ -33,17 +44,23 @@ func (f *Formatter) HitMessage(h HitView) string {
 
 	kwEsc := html.EscapeString(kw)
 	reasonEsc := html.EscapeString(reason)
-	txtEsc := html.EscapeString(txt)
 	linkEsc := html.EscapeString(link)
 	tagEsc := html.EscapeString(tag)
 
 	b := &strings.Builder{}
+	if h.Deleted {
+		b.WriteString("<b>[deleted from channel]</b>\n\n")
+	}
 	fmt.Fprintf(
 		b,
-		"keyword: %s\n\n%s\n\n<b>reason: %s</b>\n\n%s",
-		kwEsc, txtEsc, reasonEsc, linkEsc,
+		"%s: %s\n\n%s\n\n<b>reason: %s</b>\n\n%s",
+		kwLabel, kwEsc, txtEsc, reasonEsc, linkEsc,
 	)
 
+	if stats := statsLine(h); stats != "" {
+		fmt.Fprintf(b, "\n%s", html.EscapeString(stats))
+	}
+
 	if tagEsc != "" {
 		fmt.Fprintf(b, "\n\n%s", tagEsc)
 	}
@@ -51,6 +68,21 @@ func (f *Formatter) HitMessage(h HitView) string {
 	return b.String()
 }
 
+// statsLine собирает строку вида "photo · views: 1200 · forwards: 15"
+func statsLine(h HitView) string {
+	parts := make([]string, 0, 3)
+	if mt := strings.TrimSpace(h.MediaType); mt != "" {
+		parts = append(parts, mt)
+	}
+	if h.Views != nil {
+		parts = append(parts, fmt.Sprintf("views: %d", *h.Views))
+	}
+	if h.Forwards != nil {
+		parts = append(parts, fmt.Sprintf("forwards: %d", *h.Forwards))
+	}
+	return strings.Join(parts, " · ")
+}
+
 func truncateRunes(s string, max int) string {
 	if max <= 0 {
 		return s
@@ -63,3 +95,72 @@ func truncateRunes(s string, max int) string {
 
 	return string(r[:max]) + "…"
 }
+
+// truncateHTML режет HTML из TextHTML до max видимых рун, не ломая разметку:
+// теги в счет не идут, &amp; и прочие сущности считаются за один символ,
+// а теги, открытые к месту обрезки, закрываются
+//
+// HTML приходит из collector, так что считаем его корректным: теги вложены, кавычки закрыты
+func truncateHTML(s string, max int) string {
+	if max <= 0 {
+		return s
+	}
+
+	var (
+		b     strings.Builder
+		open  []string
+		count int
+	)
+	for i := 0; i < len(s); {
+		if s[i] == '<' {
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				// обрыв посреди тега, дальше ничего не пишем
+				break
+			}
+			tag := s[i : i+end+1]
+			if name, ok := strings.CutPrefix(tag, "</"); ok {
+				name = strings.TrimSuffix(name, ">")
+				if n := len(open); n > 0 && open[n-1] == name {
+					open = open[:n-1]
+				}
+			} else {
+				if count == max {
+					// новый тег после обрезки был бы пустым
+					b.WriteString("…")
+					break
+				}
+				name := strings.TrimSuffix(strings.TrimPrefix(tag, "<"), ">")
+				if sp := strings.IndexAny(name, " \t\n"); sp >= 0 {
+					name = name[:sp]
+				}
+				open = append(open, name)
+			}
+			b.WriteString(tag)
+			i += end + 1
+			continue
+		}
+
+		if count == max {
+			b.WriteString("…")
+			break
+		}
+
+		n := 1
+		if s[i] == '&' {
+			if semi := strings.IndexByte(s[i:], ';'); semi > 0 && semi <= 10 {
+				n = semi + 1
+			}
+		} else {
+			_, n = utf8.DecodeRuneInString(s[i:])
+		}
+		b.WriteString(s[i : i+n])
+		count++
+		i += n
+	}
+
+	for k := len(open) - 1; k >= 0; k-- {
+		b.WriteString("</" + open[k] + ">")
+	}
+	return b.String()
+}
@@ -10,7 +10,18 @@ type HitView struct {
 	Text        string
 	Link        string
 	Keyword     string
+	Keywords    []string
 	Category    string
 	Reason      string
 	Confidence  *float64
+
+	// TextHTML это Text с разметкой из поста (HTML для Bot API), пусто если ее нет
+	TextHTML string
+
+	MediaType string
+	Views     *int
+	Forwards  *int
+
+	// Deleted: исходное сообщение удалено из канала, ссылка уже не откроется
+	Deleted bool
 }
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS hit_keywords (
+    id           BIGSERIAL PRIMARY KEY,
+    hit_id       BIGINT NOT NULL REFERENCES hits (id) ON DELETE CASCADE,
+    keyword      TEXT NOT NULL,
+    start_offset INTEGER NULL,
+    end_offset   INTEGER NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_hit_keywords_hit_id
+    ON hit_keywords (hit_id);
+
+CREATE INDEX IF NOT EXISTS idx_hit_keywords_keyword
+    ON hit_keywords (keyword);
+
+INSERT INTO hit_keywords (hit_id, keyword)
+SELECT h.id, h.keyword
+FROM hits h
+WHERE NOT EXISTS (
+    SELECT 1 FROM hit_keywords hk WHERE hk.hit_id = h.id
+);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS channels (
+    id         BIGSERIAL PRIMARY KEY,
+    ref        TEXT NOT NULL,
+    enabled    BOOLEAN NOT NULL DEFAULT TRUE,
+    added_by   TEXT NOT NULL DEFAULT '',
+    notes      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT channels_ref_uq UNIQUE (ref)
+);
+
+CREATE TABLE IF NOT EXISTS keywords (
+    id         BIGSERIAL PRIMARY KEY,
+    expression TEXT NOT NULL,
+    enabled    BOOLEAN NOT NULL DEFAULT TRUE,
+    added_by   TEXT NOT NULL DEFAULT '',
+    notes      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT keywords_expression_uq UNIQUE (expression)
+);
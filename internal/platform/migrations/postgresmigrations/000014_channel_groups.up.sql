@@ -0,0 +1,17 @@
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS channel_group TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_hits_channel_group
+    ON hits (channel_group);
+
+ALTER TABLE channels
+    ADD COLUMN IF NOT EXISTS group_name TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE keywords
+    ADD COLUMN IF NOT EXISTS group_name TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE keywords
+    DROP CONSTRAINT IF EXISTS keywords_expression_uq;
+
+ALTER TABLE keywords
+    ADD CONSTRAINT keywords_group_expression_uq UNIQUE (group_name, expression);
@@ -0,0 +1,15 @@
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS edit_date TIMESTAMPTZ NULL,
+    ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ NULL,
+    ADD COLUMN IF NOT EXISTS version   INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS hit_versions (
+    id         BIGSERIAL PRIMARY KEY,
+    hit_id     BIGINT NOT NULL REFERENCES hits (id) ON DELETE CASCADE,
+    version    INT NOT NULL,
+    text       TEXT NOT NULL,
+    keyword    TEXT NOT NULL,
+    edit_date  TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT hit_versions_hit_version_uq UNIQUE (hit_id, version)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ NULL;
+
+CREATE INDEX IF NOT EXISTS idx_hits_channel_message_date_alive
+    ON hits (channel, message_date DESC)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,10 @@
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS media_type TEXT NULL,
+    ADD COLUMN IF NOT EXISTS fwd_from   TEXT NULL,
+    ADD COLUMN IF NOT EXISTS views      INT NULL,
+    ADD COLUMN IF NOT EXISTS forwards   INT NULL,
+    ADD COLUMN IF NOT EXISTS reactions  INT NULL,
+    ADD COLUMN IF NOT EXISTS meta       JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_hits_views
+    ON hits (views DESC NULLS LAST);
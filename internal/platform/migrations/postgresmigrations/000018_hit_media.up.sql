@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS hit_media (
+    id         BIGSERIAL PRIMARY KEY,
+    hit_id     BIGINT NOT NULL REFERENCES hits (id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL,
+    mime_type  TEXT NULL,
+    file_name  TEXT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256     TEXT NOT NULL,
+    path       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT hit_media_hit_sha256_uq UNIQUE (hit_id, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hit_media_hit_id
+    ON hit_media (hit_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS channel_health (
+    channel              TEXT PRIMARY KEY,
+    last_attempt_at      TIMESTAMPTZ NULL,
+    last_success_at      TIMESTAMPTZ NULL,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    last_error           TEXT NULL,
+    stop_reason          TEXT NULL,
+    quarantined_until    TIMESTAMPTZ NULL,
+    alerted_at           TIMESTAMPTZ NULL,
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_health_quarantined_until
+    ON channel_health (quarantined_until)
+    WHERE quarantined_until IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE checkpoints
+    ADD COLUMN IF NOT EXISTS oldest_message_id     BIGINT NULL,
+    ADD COLUMN IF NOT EXISTS oldest_message_date   TIMESTAMPTZ NULL,
+    ADD COLUMN IF NOT EXISTS backfill_completed_at TIMESTAMPTZ NULL;
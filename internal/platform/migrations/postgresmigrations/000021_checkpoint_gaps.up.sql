@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS checkpoint_gaps (
+    id               BIGSERIAL PRIMARY KEY,
+    channel_username TEXT NOT NULL,
+    from_message_id  BIGINT NOT NULL,
+    to_message_id    BIGINT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (from_message_id <= to_message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_checkpoint_gaps_channel
+    ON checkpoint_gaps (channel_username, to_message_id DESC);
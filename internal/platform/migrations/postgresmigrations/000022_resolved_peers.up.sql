@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS resolved_peers (
+    source_key  TEXT PRIMARY KEY,
+    channel_id  BIGINT NOT NULL,
+    access_hash BIGINT NOT NULL,
+    title       TEXT NOT NULL DEFAULT '',
+    username    TEXT NOT NULL DEFAULT '',
+    resolved_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS channel_id BIGINT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS hits_channel_id_message_id_uq
+    ON hits (channel_id, message_id)
+    WHERE channel_id IS NOT NULL;
@@ -0,0 +1,8 @@
+ALTER TABLE resolved_peers
+    ADD COLUMN IF NOT EXISTS account TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE resolved_peers
+    DROP CONSTRAINT IF EXISTS resolved_peers_pkey;
+
+ALTER TABLE resolved_peers
+    ADD PRIMARY KEY (account, source_key);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS mtproto_sessions (
+    account    TEXT PRIMARY KEY,
+    data       BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
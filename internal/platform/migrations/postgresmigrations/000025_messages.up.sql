@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id            BIGSERIAL PRIMARY KEY,
+    channel       TEXT NOT NULL,
+    channel_id    BIGINT NOT NULL,
+    message_id    BIGINT NOT NULL,
+    message_date  TIMESTAMPTZ NOT NULL,
+    edit_date     TIMESTAMPTZ NULL,
+    text          TEXT NOT NULL DEFAULT '',
+    link          TEXT NOT NULL,
+    channel_group TEXT NOT NULL DEFAULT 'default',
+    views         INT NULL,
+    forwards      INT NULL,
+    reactions     INT NULL,
+    meta          JSONB NOT NULL DEFAULT '{}'::jsonb,
+    archived_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS messages_channel_id_message_id_uq
+    ON messages (channel_id, message_id);
+
+CREATE INDEX IF NOT EXISTS idx_messages_message_date
+    ON messages (message_date);
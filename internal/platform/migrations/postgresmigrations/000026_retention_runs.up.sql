@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id          BIGSERIAL PRIMARY KEY,
+    started_at  TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    cutoff      TIMESTAMPTZ NOT NULL,
+    archived    INT NOT NULL DEFAULT 0,
+    pruned      INT NOT NULL DEFAULT 0,
+    file        TEXT NULL,
+    error       TEXT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_started_at
+    ON retention_runs (started_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_hits_created_at
+    ON hits (created_at);
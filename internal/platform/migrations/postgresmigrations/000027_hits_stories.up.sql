@@ -0,0 +1,14 @@
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS simhash  BIGINT NULL,
+    ADD COLUMN IF NOT EXISTS story_id BIGINT NULL;
+
+UPDATE hits
+SET story_id = id
+WHERE story_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_hits_story_id
+    ON hits (story_id);
+
+CREATE INDEX IF NOT EXISTS idx_hits_simhash_message_date
+    ON hits (message_date)
+    WHERE simhash IS NOT NULL;
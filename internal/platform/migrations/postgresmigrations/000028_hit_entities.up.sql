@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS hit_entities (
+    id           BIGSERIAL PRIMARY KEY,
+    hit_id       BIGINT NOT NULL REFERENCES hits (id) ON DELETE CASCADE,
+    type         TEXT NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset   INTEGER NOT NULL,
+    value        TEXT NULL,
+    domain       TEXT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_hit_entities_hit_id
+    ON hit_entities (hit_id);
+
+CREATE INDEX IF NOT EXISTS idx_hit_entities_domain
+    ON hit_entities (domain)
+    WHERE domain IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_hit_entities_type_value
+    ON hit_entities (type, value)
+    WHERE value IS NOT NULL;
+
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS entities JSONB NOT NULL DEFAULT '[]'::jsonb;
@@ -0,0 +1,2 @@
+ALTER TABLE hits
+    ADD COLUMN IF NOT EXISTS text_html TEXT NULL;
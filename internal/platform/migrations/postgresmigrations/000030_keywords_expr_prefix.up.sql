@@ -0,0 +1,11 @@
+UPDATE keywords k
+SET expression = 'expr:' || k.expression,
+    updated_at = NOW()
+WHERE k.expression NOT ILIKE 'expr:%'
+  AND k.expression ~ '["()]|(^|\s)/|(^|\s)(stem|exact|substr):|(^|[\s()"])(AND|OR|NOT)($|[\s()"])'
+  AND NOT EXISTS (
+      SELECT 1
+      FROM keywords d
+      WHERE d.group_name = k.group_name
+        AND d.expression = 'expr:' || k.expression
+  );
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_hit_media_path
+    ON hit_media (path);
@@ -0,0 +1,57 @@
+package searchtext
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// simhashShingle это длина шингла в словах
+const simhashShingle = 3
+
+// SimHash считает 64-битный отпечаток текста для поиска почти одинаковых текстов:
+// у похожих текстов отпечатки отличаются в немногих битах (расстояние Хэмминга)
+//
+// текст нормализуется через Normalize и режется на шинглы по 3 слова подряд,
+// так что регистр, пунктуация и эмодзи на отпечаток не влияют.
+// ok = false, если слов меньше minWords: у коротких текстов похожими оказываются
+// совсем разные сообщения
+func SimHash(text string, minWords int) (uint64, bool) {
+	words := strings.Fields(Normalize(text))
+	if len(words) == 0 || len(words) < minWords {
+		return 0, false
+	}
+
+	n := simhashShingle
+	if len(words) < n {
+		n = len(words)
+	}
+
+	var v [64]int
+	h := fnv.New64a()
+	for i := 0; i+n <= len(words); i++ {
+		h.Reset()
+		for j, w := range words[i : i+n] {
+			if j > 0 {
+				_, _ = h.Write([]byte{' '})
+			}
+			_, _ = h.Write([]byte(w))
+		}
+
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<b) != 0 {
+				v[b]++
+			} else {
+				v[b]--
+			}
+		}
+	}
+
+	var out uint64
+	for b := 0; b < 64; b++ {
+		if v[b] > 0 {
+			out |= 1 << b
+		}
+	}
+	return out, true
+}
@@ -0,0 +1,197 @@
+package searchtext
+
+// Stem возвращает основу слова по алгоритму Snowball для русского языка
+// http://snowball.tartarus.org/algorithms/russian/stemmer.html
+//
+// на вход ждет слово уже после нормализации (нижний регистр, ё -> е),
+// например из Words. Слова без русских гласных возвращаются как есть
+func Stem(word string) string {
+	rs := []rune(word)
+
+	pV, p2 := stemRegions(rs)
+	if pV >= len(rs) {
+		return word
+	}
+
+	// шаг 1
+	if n, ok := stemAmong(rs, pV, perfectiveGerund...); ok {
+		rs = rs[:len(rs)-n]
+	} else {
+		if n, ok := stemAmong(rs, pV, reflexive...); ok {
+			rs = rs[:len(rs)-n]
+		}
+
+		if n, ok := stemAmong(rs, pV, adjective...); ok {
+			rs = rs[:len(rs)-n]
+			if n, ok := stemAmong(rs, pV, participle...); ok {
+				rs = rs[:len(rs)-n]
+			}
+		} else if n, ok := stemAmong(rs, pV, verb...); ok {
+			rs = rs[:len(rs)-n]
+		} else if n, ok := stemAmong(rs, pV, noun...); ok {
+			rs = rs[:len(rs)-n]
+		}
+	}
+
+	// шаг 2
+	if stemHasSuffix(rs, pV, "и") {
+		rs = rs[:len(rs)-1]
+	}
+
+	// шаг 3
+	if n, ok := stemAmong(rs, p2, derivational...); ok {
+		rs = rs[:len(rs)-n]
+	}
+
+	// шаг 4
+	if n, ok := stemAmong(rs, pV, superlative...); ok {
+		rs = rs[:len(rs)-n]
+		if stemHasSuffix(rs, pV, "нн") {
+			rs = rs[:len(rs)-1]
+		}
+	} else if stemHasSuffix(rs, pV, "нн") {
+		rs = rs[:len(rs)-1]
+	} else if stemHasSuffix(rs, pV, "ь") {
+		rs = rs[:len(rs)-1]
+	}
+
+	return string(rs)
+}
+
+// stemEndings это группа окончаний алгоритма
+// afterAYa значит что перед окончанием должна стоять а или я, сама буква остается
+type stemEndings struct {
+	suffixes []string
+	afterAYa bool
+}
+
+var (
+	perfectiveGerund = []stemEndings{
+		{suffixes: []string{"в", "вши", "вшись"}, afterAYa: true},
+		{suffixes: []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}},
+	}
+	reflexive = []stemEndings{
+		{suffixes: []string{"ся", "сь"}},
+	}
+	adjective = []stemEndings{
+		{suffixes: []string{
+			"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+			"его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею",
+		}},
+	}
+	participle = []stemEndings{
+		{suffixes: []string{"ем", "нн", "вш", "ющ", "щ"}, afterAYa: true},
+		{suffixes: []string{"ивш", "ывш", "ующ"}},
+	}
+	verb = []stemEndings{
+		{suffixes: []string{
+			"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно",
+		}, afterAYa: true},
+		{suffixes: []string{
+			"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен",
+			"ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю",
+		}},
+	}
+	noun = []stemEndings{
+		{suffixes: []string{
+			"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й",
+			"иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я",
+		}},
+	}
+	superlative = []stemEndings{
+		{suffixes: []string{"ейш", "ейше"}},
+	}
+	derivational = []stemEndings{
+		{suffixes: []string{"ост", "ость"}},
+	}
+)
+
+// stemAmong ищет самое длинное окончание из всех групп целиком внутри региона [limit:]
+// как и among в snowball: если у самого длинного не выполнилось условие,
+// более короткие уже не пробуем
+func stemAmong(rs []rune, limit int, groups ...stemEndings) (int, bool) {
+	best := 0
+	bestAYa := false
+
+	for _, g := range groups {
+		for _, suf := range g.suffixes {
+			n := len([]rune(suf))
+			if n <= best || !stemHasSuffix(rs, limit, suf) {
+				continue
+			}
+			best = n
+			bestAYa = g.afterAYa
+		}
+	}
+
+	if best == 0 {
+		return 0, false
+	}
+	if bestAYa {
+		i := len(rs) - best - 1
+		if i < limit || (rs[i] != 'а' && rs[i] != 'я') {
+			return 0, false
+		}
+	}
+	return best, true
+}
+
+func stemHasSuffix(rs []rune, limit int, suf string) bool {
+	sr := []rune(suf)
+	start := len(rs) - len(sr)
+	if start < limit || start < 0 {
+		return false
+	}
+	for i, r := range sr {
+		if rs[start+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// stemRegions считает начало RV (после первой гласной) и R2
+func stemRegions(rs []rune) (int, int) {
+	pV, p2 := len(rs), len(rs)
+
+	i := 0
+	for i < len(rs) && !isRuVowel(rs[i]) {
+		i++
+	}
+	if i >= len(rs) {
+		return pV, p2
+	}
+	pV = i + 1
+
+	// R1: после первой согласной, которая идет за гласной
+	for i < len(rs) && isRuVowel(rs[i]) {
+		i++
+	}
+	if i >= len(rs) {
+		return pV, p2
+	}
+	i++
+
+	// R2: то же самое внутри R1
+	for i < len(rs) && !isRuVowel(rs[i]) {
+		i++
+	}
+	for i < len(rs) && isRuVowel(rs[i]) {
+		i++
+	}
+	if i >= len(rs) {
+		return pV, p2
+	}
+	p2 = i + 1
+
+	return pV, p2
+}
+
+func isRuVowel(r rune) bool {
+	switch r {
+	case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,53 @@
+package searchtext
+
+import "unicode"
+
+// Word это одно слово текста после той же нормализации что и в Normalize
+// Start и End это позиции в рунах исходной строки, End не включительно
+type Word struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Words режет текст на слова по тем же правилам что Normalize:
+// нижний регистр, ё -> е, словом считается подряд идущие буквы и цифры
+func Words(s string) []Word {
+	var (
+		out   []Word
+		cur   []rune
+		start int
+		pos   int
+	)
+
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		out = append(out, Word{Text: string(cur), Start: start, End: pos})
+		cur = cur[:0]
+	}
+
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if len(cur) == 0 {
+				start = pos
+			}
+			cur = append(cur, normalizeRune(r))
+		} else {
+			flush()
+		}
+		pos++
+	}
+	flush()
+
+	return out
+}
+
+func normalizeRune(r rune) rune {
+	r = unicode.ToLower(r)
+	if r == 'ё' {
+		return 'е'
+	}
+	return r
+}
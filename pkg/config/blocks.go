@@ -180,6 +180,34 @@ func (t *TelegramBot) Validate(enabled bool) error {
 	return nil
 }
 
+// Retention это чистка hits старше scrape.dedup_window по расписанию
+// перед удалением hits выгружаются в Dir файлами hits-<время>.jsonl.gz
+type Retention struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Interval  time.Duration `mapstructure:"interval"`
+	Dir       string        `mapstructure:"dir"`
+	BatchSize int           `mapstructure:"batch_size"`
+}
+
+func (r *Retention) Validate() error {
+	if r == nil {
+		return errors.New("retention config is nil")
+	}
+	if !r.Enabled {
+		return nil
+	}
+	if r.Interval <= 0 {
+		return errors.New("retention.interval must be > 0")
+	}
+	if strings.TrimSpace(r.Dir) == "" {
+		return errors.New("retention.dir is required: hits are archived there before pruning")
+	}
+	if r.BatchSize <= 0 {
+		return errors.New("retention.batch_size must be > 0")
+	}
+	return nil
+}
+
 type MTProto struct {
 	APIID                int    `mapstructure:"api_id"`
 	APIHash              string `mapstructure:"api_hash"`
@@ -190,6 +218,111 @@ type MTProto struct {
 	AllowInteractiveAuth bool   `mapstructure:"allow_interactive_auth"`
 	Device               Device `mapstructure:"device"`
 	RateLimit            Rate   `mapstructure:"rate_limit"`
+
+	// Accounts это пул аккаунтов, между которыми раскладываются каналы
+	// пустой список значит один аккаунт DefaultMTProtoAccount из полей выше
+	Accounts []MTProtoAccount `mapstructure:"accounts"`
+
+	Login MTProtoLogin `mapstructure:"login"`
+
+	SessionStore MTProtoSessionStore `mapstructure:"session_store"`
+}
+
+// MTProtoSessionStore это где лежат сессии аккаунтов
+//
+// file: json по путям session как раньше. postgres: таблица mtproto_sessions,
+// сессия шифруется ключом, так что бэкап базы не дает войти в аккаунт,
+// а реплики collector могут пользоваться одной и той же сессией
+type MTProtoSessionStore struct {
+	Driver string `mapstructure:"driver"`
+	// Key это 32 байта в base64 (openssl rand -base64 32)
+	Key string `mapstructure:"key"`
+	// KeyFile: ключ лежит в файле, например docker secret. Используется, если key пустой
+	KeyFile string `mapstructure:"key_file"`
+}
+
+const (
+	SessionStoreFile     = "file"
+	SessionStorePostgres = "postgres"
+)
+
+// MTProtoLogin это настройки команды `tgcollector login`, которая создает файл сессии
+// без stdin: QR в терминале или код через локальную форму / файл
+type MTProtoLogin struct {
+	// Method: qr (сканировать из приложения Telegram: Настройки -> Устройства) или code
+	Method string `mapstructure:"method"`
+	// HTTPAddr: если задан, код, телефон и пароль 2FA вводятся через форму на этом адресе
+	HTTPAddr string `mapstructure:"http_addr"`
+	// CodeFile: иначе ждем файл с кодом по этому пути,
+	// телефон в <code_file>.phone, пароль 2FA в <code_file>.password
+	CodeFile string `mapstructure:"code_file"`
+	// Timeout на вход одного аккаунта
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+const (
+	MTProtoLoginQR   = "qr"
+	MTProtoLoginCode = "code"
+)
+
+func (l MTProtoLogin) Validate() error {
+	switch l.Method {
+	case MTProtoLoginQR, MTProtoLoginCode:
+	default:
+		return fmt.Errorf("mtproto.login.method must be %q or %q", MTProtoLoginQR, MTProtoLoginCode)
+	}
+	if l.Timeout < 0 {
+		return errors.New("mtproto.login.timeout must be >= 0")
+	}
+	return nil
+}
+
+const DefaultMTProtoAccount = "default"
+
+// MTProtoAccount это один аккаунт пула со своим файлом сессии
+// пустые phone, password и поля device берутся из mtproto
+type MTProtoAccount struct {
+	Name     string `mapstructure:"name"`
+	Session  string `mapstructure:"session"`
+	Phone    string `mapstructure:"phone"`
+	Password string `mapstructure:"password"`
+	Device   Device `mapstructure:"device"`
+}
+
+// AccountList отдает аккаунты пула с уже подставленными общими настройками
+func (m MTProto) AccountList() []MTProtoAccount {
+	if len(m.Accounts) == 0 {
+		return []MTProtoAccount{{
+			Name:     DefaultMTProtoAccount,
+			Session:  m.Session,
+			Phone:    m.Phone,
+			Password: m.Password,
+			Device:   m.Device,
+		}}
+	}
+
+	out := make([]MTProtoAccount, 0, len(m.Accounts))
+	for _, a := range m.Accounts {
+		if a.Phone == "" {
+			a.Phone = m.Phone
+		}
+		if a.Password == "" {
+			a.Password = m.Password
+		}
+		a.Device = a.Device.inherit(m.Device)
+		out = append(out, a)
+	}
+	return out
+}
+
+// ForAccount это настройки MTProto для одного аккаунта пула
+func (m MTProto) ForAccount(a MTProtoAccount) MTProto {
+	m.Session = a.Session
+	m.Phone = a.Phone
+	m.Password = a.Password
+	m.Device = a.Device
+	m.Accounts = nil
+	return m
 }
 
 type Device struct {
@@ -200,9 +333,52 @@ type Device struct {
 	SystemLang string `mapstructure:"system_lang"`
 }
 
+func (d Device) inherit(base Device) Device {
+	if d.Model == "" {
+		d.Model = base.Model
+	}
+	if d.System == "" {
+		d.System = base.System
+	}
+	if d.AppVersion == "" {
+		d.AppVersion = base.AppVersion
+	}
+	if d.LangCode == "" {
+		d.LangCode = base.LangCode
+	}
+	if d.SystemLang == "" {
+		d.SystemLang = base.SystemLang
+	}
+	return d
+}
+
 type Rate struct {
 	MinDelay    time.Duration `mapstructure:"min_delay"`
 	Concurrency int           `mapstructure:"concurrency"`
+
+	// MaxDelay это потолок паузы между запросами, до которого она растет после FLOOD_WAIT
+	MaxDelay time.Duration `mapstructure:"max_delay"`
+	// MaxFloodWait: FLOOD_WAIT дольше этого не ждем, а сразу отдаем ошибку. 0 -> ждем сколько скажут
+	// MaxRetries: сколько раз повторять запрос после FLOOD_WAIT, 0 -> не повторять
+	// оба указатели, чтобы явный 0 в конфиге отличался от незаданного (nil -> значение по умолчанию)
+	MaxFloodWait *time.Duration `mapstructure:"max_flood_wait"`
+	MaxRetries   *int           `mapstructure:"max_retries"`
+}
+
+// FloodWaitLimit это MaxFloodWait, 0 если не задан
+func (r Rate) FloodWaitLimit() time.Duration {
+	if r.MaxFloodWait == nil {
+		return 0
+	}
+	return *r.MaxFloodWait
+}
+
+// Retries это MaxRetries, 0 если не задан
+func (r Rate) Retries() int {
+	if r.MaxRetries == nil {
+		return 0
+	}
+	return *r.MaxRetries
 }
 
 func (m *MTProto) Validate() error {
@@ -241,13 +417,59 @@ func (m *MTProto) Validate() error {
 	if m.RateLimit.Concurrency <= 0 {
 		return errors.New("mtproto.rate_limit.concurrency must be > 0")
 	}
+	if m.RateLimit.MaxDelay < 0 {
+		return errors.New("mtproto.rate_limit.max_delay must be >= 0")
+	}
+	if m.RateLimit.FloodWaitLimit() < 0 {
+		return errors.New("mtproto.rate_limit.max_flood_wait must be >= 0")
+	}
+	if m.RateLimit.Retries() < 0 {
+		return errors.New("mtproto.rate_limit.max_retries must be >= 0")
+	}
+
+	switch m.SessionStore.Driver {
+	case "", SessionStoreFile:
+	case SessionStorePostgres:
+		if strings.TrimSpace(m.SessionStore.Key) == "" && strings.TrimSpace(m.SessionStore.KeyFile) == "" {
+			return errors.New("mtproto.session_store.key or key_file is required for postgres session store")
+		}
+	default:
+		return fmt.Errorf("mtproto.session_store.driver must be %q or %q", SessionStoreFile, SessionStorePostgres)
+	}
+
+	names := map[string]struct{}{}
+	sessions := map[string]struct{}{}
+	for i := range m.Accounts {
+		a := &m.Accounts[i]
+		a.Name = strings.TrimSpace(a.Name)
+		a.Session = strings.TrimSpace(a.Session)
+		if a.Name == "" {
+			return fmt.Errorf("mtproto.accounts[%d].name is required", i)
+		}
+		if a.Session == "" {
+			return fmt.Errorf("mtproto.accounts[%d].session is required", i)
+		}
+		if _, ok := names[a.Name]; ok {
+			return fmt.Errorf("mtproto.accounts[%d]: duplicate account name %q", i, a.Name)
+		}
+		if _, ok := sessions[a.Session]; ok {
+			return fmt.Errorf("mtproto.accounts[%d]: session %q is used by another account", i, a.Session)
+		}
+		names[a.Name] = struct{}{}
+		sessions[a.Session] = struct{}{}
+	}
 
 	return nil
 }
 
 type Scrape struct {
-	Keywords []string `mapstructure:"keywords"`
-	Channels []string `mapstructure:"channels"`
+	Keywords    []string `mapstructure:"keywords"`
+	KeywordMode string   `mapstructure:"keyword_mode"`
+	Channels    []string `mapstructure:"channels"`
+
+	// Groups это именованные группы каналов со своими ключевыми словами
+	// каналы и ключевые слова верхнего уровня образуют группу DefaultScrapeGroup
+	Groups []ScrapeGroup `mapstructure:"groups"`
 
 	Lookback    time.Duration `mapstructure:"lookback"`
 	DedupWindow time.Duration `mapstructure:"dedup_window"`
@@ -256,7 +478,112 @@ type Scrape struct {
 	MinDelay             time.Duration `mapstructure:"min_delay"`
 	BetweenChannelsDelay time.Duration `mapstructure:"between_channels_delay"`
 
+	// EditWindow: при обходе перечитывать сообщения за чекпоинтом не старше этого окна,
+	// чтобы заметить правки. 0 выключает
+	EditWindow time.Duration `mapstructure:"edit_window"`
+
+	DeletedCheck ScrapeDeletedCheck `mapstructure:"deleted_check"`
+
+	Media ScrapeMedia `mapstructure:"media"`
+
+	Health ScrapeHealth `mapstructure:"health"`
+
 	Interval time.Duration `mapstructure:"interval"`
+
+	Realtime ScrapeRealtime `mapstructure:"realtime"`
+
+	Backfill ScrapeBackfill `mapstructure:"backfill"`
+
+	Archive ScrapeArchive `mapstructure:"archive"`
+
+	Stories ScrapeStories `mapstructure:"stories"`
+}
+
+// ScrapeArchive это архив всех просмотренных сообщений (таблица messages)
+// по нему `tgcollector rematch` находит старые сообщения под новые выражения
+// Retention: сообщения старше этого удаляются после каждого обхода
+type ScrapeArchive struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// ScrapeStories это склейка репостов: hits из разных каналов с почти одинаковым текстом
+// получают общий story_id. Похожесть считается по SimHash нормализованного текста
+// MaxDistance: сколько бит из 64 могут отличаться. Window: насколько далеко по времени
+// могут быть сообщения одной истории. MinWords: тексты короче в историях не склеиваются
+type ScrapeStories struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Window      time.Duration `mapstructure:"window"`
+	MaxDistance int           `mapstructure:"max_distance"`
+	MinWords    int           `mapstructure:"min_words"`
+}
+
+// ScrapeRealtime включает прием новых сообщений через поток обновлений MTProto
+// обычный обход при этом остается и добирает пропущенное раз в PollInterval
+type ScrapeRealtime struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+// ScrapeBackfill это догрузка истории каналов назад до Since (дата 2006-01-02)
+// идет после каждого обхода кусками по ChunkSize сообщений на канал,
+// либо отдельной командой `tgcollector backfill`
+type ScrapeBackfill struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Since     string        `mapstructure:"since"`
+	ChunkSize int           `mapstructure:"chunk_size"`
+	MinDelay  time.Duration `mapstructure:"min_delay"`
+	Notify    bool          `mapstructure:"notify"`
+}
+
+const backfillSinceLayout = "2006-01-02"
+
+// SinceTime отдает since как полночь UTC, нулевое время если since не задан
+func (b ScrapeBackfill) SinceTime() time.Time {
+	t, err := time.Parse(backfillSinceLayout, strings.TrimSpace(b.Since))
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// ScrapeDeletedCheck: раз в Interval перепроверять hits не старше Window
+// и помечать удаленные из канала. Window = 0 выключает проверку
+type ScrapeDeletedCheck struct {
+	Window   time.Duration `mapstructure:"window"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// ScrapeMedia это скачивание фото и документов из новых hits в локальную папку
+type ScrapeMedia struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Dir            string `mapstructure:"dir"`
+	MaxFileBytes   int64  `mapstructure:"max_file_bytes"`
+	RunBudgetBytes int64  `mapstructure:"run_budget_bytes"`
+}
+
+// ScrapeHealth это карантин каналов, которые падают несколько обходов подряд
+// QuarantineAfter = 0 выключает карантин, ошибки при этом все равно пишутся в channel_health
+type ScrapeHealth struct {
+	QuarantineAfter int           `mapstructure:"quarantine_after"`
+	BackoffBase     time.Duration `mapstructure:"backoff_base"`
+	BackoffMax      time.Duration `mapstructure:"backoff_max"`
+}
+
+const DefaultScrapeGroup = "default"
+
+// ScrapeGroup переопределяет настройки обхода для своих каналов
+// пустые/нулевые поля наследуются из scrape, пустой keywords тоже
+type ScrapeGroup struct {
+	Name        string   `mapstructure:"name"`
+	Channels    []string `mapstructure:"channels"`
+	Keywords    []string `mapstructure:"keywords"`
+	KeywordMode string   `mapstructure:"keyword_mode"`
+
+	Lookback             time.Duration `mapstructure:"lookback"`
+	PerChannelMaxScan    int           `mapstructure:"per_channel_max_scan"`
+	MinDelay             time.Duration `mapstructure:"min_delay"`
+	BetweenChannelsDelay time.Duration `mapstructure:"between_channels_delay"`
 }
 
 func (s *Scrape) Validate() error {
@@ -264,32 +591,32 @@ func (s *Scrape) Validate() error {
 		return errors.New("scrape config is nil")
 	}
 
-	for i := range s.Keywords {
-		s.Keywords[i] = strings.TrimSpace(strings.ToLower(s.Keywords[i]))
-	}
-	kw := s.Keywords[:0]
-	for _, k := range s.Keywords {
-		if k != "" {
-			kw = append(kw, k)
-		}
-	}
-	s.Keywords = kw
-	if len(s.Keywords) == 0 {
+	s.Keywords = normalizeKeywords(s.Keywords)
+	s.Channels = trimNonEmpty(s.Channels)
+
+	if len(s.Channels) > 0 && len(s.Keywords) == 0 {
 		return errors.New("scrape.keywords must contain at least 1 keyword")
 	}
 
-	for i := range s.Channels {
-		s.Channels[i] = strings.TrimSpace(s.Channels[i])
+	s.KeywordMode = strings.ToLower(strings.TrimSpace(s.KeywordMode))
+	if !isKeywordMode(s.KeywordMode) {
+		return fmt.Errorf("scrape.keyword_mode must be one of [substring, exact, stem], got %q", s.KeywordMode)
 	}
-	ch := s.Channels[:0]
-	for _, c := range s.Channels {
-		if c != "" {
-			ch = append(ch, c)
+
+	names := map[string]struct{}{DefaultScrapeGroup: {}}
+	for i := range s.Groups {
+		g := &s.Groups[i]
+		if err := g.Validate(); err != nil {
+			return fmt.Errorf("scrape.groups[%d]: %w", i, err)
+		}
+		if _, ok := names[g.Name]; ok {
+			return fmt.Errorf("scrape.groups[%d]: duplicate group name %q", i, g.Name)
+		}
+		names[g.Name] = struct{}{}
+
+		if len(g.Keywords) == 0 && len(s.Keywords) == 0 {
+			return fmt.Errorf("scrape.groups[%d]: keywords are empty and there is nothing to inherit", i)
 		}
-	}
-	s.Channels = ch
-	if len(s.Channels) == 0 {
-		return errors.New("scrape.channels must contain at least 1 channel")
 	}
 
 	if s.Lookback <= 0 {
@@ -308,9 +635,155 @@ func (s *Scrape) Validate() error {
 	if s.BetweenChannelsDelay < 0 {
 		return errors.New("scrape.between_channels_delay must be >= 0")
 	}
+	if s.EditWindow < 0 {
+		return errors.New("scrape.edit_window must be >= 0")
+	}
+	if s.DeletedCheck.Window < 0 {
+		return errors.New("scrape.deleted_check.window must be >= 0")
+	}
+	if s.DeletedCheck.Window > 0 && s.DeletedCheck.Interval <= 0 {
+		return errors.New("scrape.deleted_check.interval must be > 0")
+	}
+	if s.Media.Enabled {
+		s.Media.Dir = strings.TrimSpace(s.Media.Dir)
+		if s.Media.Dir == "" {
+			return errors.New("scrape.media.dir is required when media is enabled")
+		}
+		if s.Media.MaxFileBytes <= 0 {
+			return errors.New("scrape.media.max_file_bytes must be > 0")
+		}
+		if s.Media.RunBudgetBytes < 0 {
+			return errors.New("scrape.media.run_budget_bytes must be >= 0")
+		}
+	}
+	if s.Health.QuarantineAfter < 0 {
+		return errors.New("scrape.health.quarantine_after must be >= 0")
+	}
+	if s.Health.QuarantineAfter > 0 && s.Health.BackoffBase <= 0 {
+		return errors.New("scrape.health.backoff_base must be > 0")
+	}
+	if s.Health.QuarantineAfter > 0 && s.Health.BackoffMax < s.Health.BackoffBase {
+		return errors.New("scrape.health.backoff_max must be >= backoff_base")
+	}
 	if s.Interval <= 0 {
 		return errors.New("scrape.interval must be > 0")
 	}
+	if s.Realtime.Enabled && s.Realtime.PollInterval <= 0 {
+		return errors.New("scrape.realtime.poll_interval must be > 0 when realtime is enabled")
+	}
+	if s.Backfill.Since = strings.TrimSpace(s.Backfill.Since); s.Backfill.Since != "" {
+		if _, err := time.Parse(backfillSinceLayout, s.Backfill.Since); err != nil {
+			return fmt.Errorf("scrape.backfill.since must be a date like 2024-01-31, got %q", s.Backfill.Since)
+		}
+	}
+	if s.Backfill.Enabled && s.Backfill.Since == "" {
+		return errors.New("scrape.backfill.since is required when backfill is enabled")
+	}
+	if s.Backfill.ChunkSize < 0 {
+		return errors.New("scrape.backfill.chunk_size must be >= 0")
+	}
+	if s.Backfill.MinDelay < 0 {
+		return errors.New("scrape.backfill.min_delay must be >= 0")
+	}
+	if s.Archive.Retention < 0 {
+		return errors.New("scrape.archive.retention must be >= 0")
+	}
+	if s.Stories.Window < 0 {
+		return errors.New("scrape.stories.window must be >= 0")
+	}
+	if s.Stories.MaxDistance < 0 || s.Stories.MaxDistance > 64 {
+		return errors.New("scrape.stories.max_distance must be in [0, 64]")
+	}
+	if s.Stories.MinWords < 0 {
+		return errors.New("scrape.stories.min_words must be >= 0")
+	}
+
+	return nil
+}
+
+func (g *ScrapeGroup) Validate() error {
+	if g == nil {
+		return errors.New("group config is nil")
+	}
+
+	g.Name = strings.ToLower(strings.TrimSpace(g.Name))
+	if g.Name == "" {
+		return errors.New("name is required")
+	}
+
+	g.Keywords = normalizeKeywords(g.Keywords)
+	g.Channels = trimNonEmpty(g.Channels)
+
+	g.KeywordMode = strings.ToLower(strings.TrimSpace(g.KeywordMode))
+	if g.KeywordMode != "" && !isKeywordMode(g.KeywordMode) {
+		return fmt.Errorf("keyword_mode must be one of [substring, exact, stem], got %q", g.KeywordMode)
+	}
+
+	if g.Lookback < 0 {
+		return errors.New("lookback must be >= 0")
+	}
+	if g.PerChannelMaxScan < 0 {
+		return errors.New("per_channel_max_scan must be >= 0")
+	}
+	if g.MinDelay < 0 {
+		return errors.New("min_delay must be >= 0")
+	}
+	if g.BetweenChannelsDelay < 0 {
+		return errors.New("between_channels_delay must be >= 0")
+	}
 
 	return nil
 }
+
+func isKeywordMode(s string) bool {
+	switch s {
+	case "substring", "exact", "stem":
+		return true
+	default:
+		return false
+	}
+}
+
+// KeywordExprPrefix помечает ключевое слово как выражение (AND/OR/NOT, "фраза", /регулярка/)
+// должен совпадать с keywords.ExprPrefix в collector
+const KeywordExprPrefix = "expr:"
+
+// normalizeKeywords приводит обычные ключевые слова к нижнему регистру, как раньше,
+// и выкидывает дубли без учета регистра. Выражения не трогаем: в них операторы
+// пишутся капсом, а регулярки чувствительны к \S, \W и т.п.
+func normalizeKeywords(in []string) []string {
+	out := in[:0]
+	seen := make(map[string]struct{}, len(in))
+	for _, v := range in {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		key := v
+		if len(v) >= len(KeywordExprPrefix) && strings.EqualFold(v[:len(KeywordExprPrefix)], KeywordExprPrefix) {
+			key = KeywordExprPrefix + strings.TrimSpace(v[len(KeywordExprPrefix):])
+		} else {
+			v = strings.ToLower(v)
+			key = v
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
+
+func trimNonEmpty(in []string) []string {
+	out := in[:0]
+	for _, v := range in {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -127,6 +127,14 @@ func (w *Worker) Run(ctx context.Context) error {
 }
 
 func (w *Worker) tick(ctx context.Context) error {
+	copied, err := w.store.CopyStoryClassifications(ctx)
+	if err != nil {
+		return err
+	}
+	if copied > 0 {
+		w.log.Info("story classifications copied", "count", copied)
+	}
+
 	hits, err := w.store.ClaimUnclassifiedHits(ctx, storage.ClaimOptions{
 		Limit:           w.cfg.BatchSize,
 		WorkerID:        w.cfg.WorkerID,
@@ -170,8 +178,12 @@ func (w *Worker) classifyOne(ctx context.Context, h storage.Hit) error {
 		w.cfg.PromptPath,
 		classifierprompt.StrictReasonInput{
 			Keyword:        h.Keyword,
+			Keywords:       h.Keywords,
 			Text:           text,
 			CompaniesFound: companiesFound,
+			Domains:        h.Domains,
+			Mentions:       h.Mentions,
+			Hashtags:       h.Hashtags,
 		},
 	)
 	if err != nil {
@@ -244,6 +256,7 @@ func (w *Worker) classifyOne(ctx context.Context, h storage.Hit) error {
 			"channel", h.Channel,
 			"message_id", h.MessageID,
 			"keyword", h.Keyword,
+			"keywords_count", len(h.Keywords),
 			"category", cat,
 			"confidence", cls.Confidence,
 		)
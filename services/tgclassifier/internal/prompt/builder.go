@@ -12,8 +12,13 @@ const embeddedTemplateFile = "classify_news_v1.tmpl"
 
 type StrictReasonInput struct {
 	Keyword        string
+	Keywords       []string
 	Text           string
 	CompaniesFound []string
+	// Domains, Mentions, Hashtags из разметки поста, ссылки часто говорят больше текста
+	Domains  []string
+	Mentions []string
+	Hashtags []string
 }
 
 func BuildStrictReasonPrompt(path string, in StrictReasonInput) (string, error) {
@@ -29,14 +34,26 @@ func BuildStrictReasonPrompt(path string, in StrictReasonInput) (string, error)
 
 	data := struct {
 		Keyword          string
+		Keywords         string
 		Text             string
 		HasTop250Company string
 		Top250Found      string
+		LinkDomains      string
+		Mentions         string
+		Hashtags         string
 	}{
 		Keyword:          in.Keyword,
+		Keywords:         in.Keyword,
 		Text:             in.Text,
 		HasTop250Company: "no",
 		Top250Found:      "",
+		LinkDomains:      strings.Join(in.Domains, ", "),
+		Mentions:         joinPrefixed("@", in.Mentions),
+		Hashtags:         joinPrefixed("#", in.Hashtags),
+	}
+
+	if len(in.Keywords) > 0 {
+		data.Keywords = strings.Join(in.Keywords, "; ")
 	}
 
 	if len(in.CompaniesFound) > 0 {
@@ -52,6 +69,14 @@ func BuildStrictReasonPrompt(path string, in StrictReasonInput) (string, error)
 	return strings.TrimSpace(buf.String()), nil
 }
 
+func joinPrefixed(prefix string, items []string) string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, prefix+it)
+	}
+	return strings.Join(out, ", ")
+}
+
 func loadTemplate(path string) (string, error) {
 	if strings.TrimSpace(path) != "" {
 		b, err := os.ReadFile(path)
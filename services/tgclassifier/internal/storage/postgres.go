@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -26,6 +27,8 @@ func (s *Postgres) Close() error {
 	return s.db.Close()
 }
 
+// ClaimUnclassifiedHits берет только первые hits историй (story_id = id):
+// остальные копии той же новости получают их классификацию без вызова LLM
 func (s *Postgres) ClaimUnclassifiedHits(ctx context.Context, opts ClaimOptions) ([]Hit, error) {
 	if s == nil || s.db == nil {
 		return nil, errors.New("postgres storage: db is nil")
@@ -55,6 +58,7 @@ WITH candidates AS (
 		)
 		AND (h.processing_until IS NULL OR h.processing_until < $1)
 		AND (NOT $2 OR h.delivered_at IS NULL)
+		AND (h.story_id IS NULL OR h.story_id = h.id)
 	ORDER BY h.message_date DESC
 	FOR UPDATE SKIP LOCKED
 	LIMIT $3
@@ -95,7 +99,37 @@ SELECT
 	classified_at,
 	llm_model,
 	llm_confidence,
-	llm_reason
+	llm_reason,
+	COALESCE((
+		SELECT STRING_AGG(k.keyword, E'\n' ORDER BY k.first_id)
+		FROM (
+			SELECT hk.keyword, MIN(hk.id) AS first_id
+			FROM hit_keywords hk
+			WHERE hk.hit_id = claimed.id
+			GROUP BY hk.keyword
+		) k
+	), keyword) AS keywords,
+	COALESCE((
+		SELECT STRING_AGG(DISTINCT he.domain, E'\n')
+		FROM hit_entities he
+		WHERE he.hit_id = claimed.id
+		  AND he.type IN ('url', 'text_url')
+		  AND he.domain IS NOT NULL
+	), '') AS domains,
+	COALESCE((
+		SELECT STRING_AGG(DISTINCT he.value, E'\n')
+		FROM hit_entities he
+		WHERE he.hit_id = claimed.id
+		  AND he.type = 'mention'
+		  AND he.value IS NOT NULL
+	), '') AS mentions,
+	COALESCE((
+		SELECT STRING_AGG(DISTINCT he.value, E'\n')
+		FROM hit_entities he
+		WHERE he.hit_id = claimed.id
+		  AND he.type = 'hashtag'
+		  AND he.value IS NOT NULL
+	), '') AS hashtags
 FROM claimed
 ORDER BY message_date DESC
 `, now, opts.OnlyUndelivered, opts.Limit, opts.WorkerID, until)
@@ -132,7 +166,13 @@ func (s *Postgres) UpdateClassification(ctx context.Context, id int64, workerID
 		c.ClassifiedAt = time.Now().UTC()
 	}
 
-	res, err := s.db.ExecContext(ctx, `
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgres update classification: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
 UPDATE hits
 SET category = $1,
     classified_at = $2,
@@ -153,9 +193,61 @@ WHERE id = $6
 		return ErrClaimLost
 	}
 
+	// остальные hits истории это та же новость, классификация у них общая
+	if _, err := tx.ExecContext(ctx, `
+UPDATE hits
+SET category = $1,
+    classified_at = $2,
+    llm_model = $3,
+    llm_confidence = $4,
+    llm_reason = $5
+WHERE story_id = $6
+  AND id <> $6
+`, c.Category, c.ClassifiedAt.UTC(), c.LLMModel, c.Confidence, c.Reason, id); err != nil {
+		return fmt.Errorf("postgres copy classification to story: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgres update classification: commit: %w", err)
+	}
+
 	return nil
 }
 
+// CopyStoryClassifications дает неклассифицированным hits классификацию первого hit их истории
+// нужно для копий, которые пришли (или были поправлены) уже после того, как первый hit классифицировали
+func (s *Postgres) CopyStoryClassifications(ctx context.Context) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("postgres storage: db is nil")
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+UPDATE hits m
+SET category = l.category,
+    classified_at = l.classified_at,
+    llm_model = l.llm_model,
+    llm_confidence = l.llm_confidence,
+    llm_reason = l.llm_reason
+FROM hits l
+WHERE l.id = m.story_id
+  AND m.id <> m.story_id
+  AND (
+      m.category IS NULL
+      OR m.llm_reason IS NULL
+      OR BTRIM(m.llm_reason) = ''
+  )
+  AND l.category IS NOT NULL
+  AND l.llm_reason IS NOT NULL
+  AND BTRIM(l.llm_reason) <> ''
+`)
+	if err != nil {
+		return 0, fmt.Errorf("postgres copy story classifications: %w", err)
+	}
+
+	affected, _ := res.RowsAffected()
+	return int(affected), nil
+}
+
 func (s *Postgres) ReleaseProcessing(ctx context.Context, id int64, workerID string) error {
 	if s == nil || s.db == nil {
 		return errors.New("postgres storage: db is nil")
@@ -193,6 +285,10 @@ func scanPostgresHits(rows *sql.Rows) ([]Hit, error) {
 			llmModel      sql.NullString
 			llmConfidence sql.NullFloat64
 			llmReason     sql.NullString
+			keywords      string
+			domains       string
+			mentions      string
+			hashtags      string
 		)
 
 		if err := rows.Scan(
@@ -210,12 +306,20 @@ func scanPostgresHits(rows *sql.Rows) ([]Hit, error) {
 			&llmModel,
 			&llmConfidence,
 			&llmReason,
+			&keywords,
+			&domains,
+			&mentions,
+			&hashtags,
 		); err != nil {
 			return nil, fmt.Errorf("postgres scan hit: %w", err)
 		}
 
 		h.MessageDate = h.MessageDate.UTC()
 		h.CreatedAt = h.CreatedAt.UTC()
+		h.Keywords = splitKeywords(keywords)
+		h.Domains = splitKeywords(domains)
+		h.Mentions = splitKeywords(mentions)
+		h.Hashtags = splitKeywords(hashtags)
 
 		if deliveredAt.Valid {
 			t := deliveredAt.Time.UTC()
@@ -251,3 +355,15 @@ func scanPostgresHits(rows *sql.Rows) ([]Hit, error) {
 
 	return out, nil
 }
+
+func splitKeywords(s string) []string {
+	parts := strings.Split(s, "\n")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -16,6 +16,10 @@ type Hit struct {
 	Text          string
 	Link          string
 	Keyword       string
+	Keywords      []string
+	Domains       []string
+	Mentions      []string
+	Hashtags      []string
 	CreatedAt     time.Time
 	DeliveredAt   *time.Time
 	Category      *string
@@ -44,5 +48,7 @@ type Store interface {
 	ClaimUnclassifiedHits(ctx context.Context, opts ClaimOptions) ([]Hit, error)
 	UpdateClassification(ctx context.Context, id int64, workerID string, c Classification) error
 	ReleaseProcessing(ctx context.Context, id int64, workerID string) error
+	// CopyStoryClassifications раздает классификацию первых hits историй остальным, отдает сколько обновили
+	CopyStoryClassifications(ctx context.Context) (int, error)
 	Close() error
 }
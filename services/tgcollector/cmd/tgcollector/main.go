@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -22,6 +23,22 @@ func main() {
 		JSON:    cfg.Logger.JSON,
 	})
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// login только создает файлы сессий, ни БД, ни обход ему не нужны
+	if len(os.Args) > 1 && os.Args[1] == "login" {
+		account := ""
+		if len(os.Args) > 2 {
+			account = os.Args[2]
+		}
+		if err := app.Login(ctx, cfg, log, account); err != nil {
+			log.Error("login failed", slog.Any("err", err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	application, err := app.New(cfg, log)
 	if err != nil {
 		log.Error("app init failed", slog.Any("err", err))
@@ -33,10 +50,24 @@ func main() {
 		}
 	}()
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-	defer stop()
+	run := application.Run
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backfill":
+			run = application.RunBackfill
+		case "rematch":
+			fs := flag.NewFlagSet("rematch", flag.ExitOnError)
+			since := fs.Duration("since", 0, "only messages newer than this, 0 -> whole archive")
+			notify := fs.Bool("notify", false, "send new hits to notifier")
+			_ = fs.Parse(os.Args[2:])
+
+			run = func(ctx context.Context) error {
+				return application.RunRematch(ctx, *since, *notify)
+			}
+		}
+	}
 
-	if err := application.Run(ctx); err != nil && !isShutdownErr(err) {
+	if err := run(ctx); err != nil && !isShutdownErr(err) {
 		log.Error("app run failed", slog.Any("err", err))
 		os.Exit(1)
 	}
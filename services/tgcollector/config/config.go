@@ -15,6 +15,8 @@ type TGCollector struct {
 
 	MTProto pcfg.MTProto `mapstructure:"mtproto"`
 	Scrape  pcfg.Scrape  `mapstructure:"scrape"`
+
+	Retention pcfg.Retention `mapstructure:"retention"`
 }
 
 func (c *TGCollector) setDefaults() {
@@ -55,7 +57,28 @@ func (c *TGCollector) setDefaults() {
 	if c.MTProto.RateLimit.Concurrency <= 0 {
 		c.MTProto.RateLimit.Concurrency = 1
 	}
+	if c.MTProto.RateLimit.MaxDelay <= 0 {
+		c.MTProto.RateLimit.MaxDelay = 30 * time.Second
+	}
+	// явный 0 оставляем: это "ждать сколько скажут" и "не повторять"
+	if c.MTProto.RateLimit.MaxFloodWait == nil {
+		d := 10 * time.Minute
+		c.MTProto.RateLimit.MaxFloodWait = &d
+	}
+	if c.MTProto.RateLimit.MaxRetries == nil {
+		n := 3
+		c.MTProto.RateLimit.MaxRetries = &n
+	}
+	if c.MTProto.Login.Method == "" {
+		c.MTProto.Login.Method = pcfg.MTProtoLoginQR
+	}
+	if c.MTProto.Login.Timeout <= 0 {
+		c.MTProto.Login.Timeout = 5 * time.Minute
+	}
 
+	if c.Scrape.KeywordMode == "" {
+		c.Scrape.KeywordMode = "substring"
+	}
 	if c.Scrape.Lookback <= 0 {
 		c.Scrape.Lookback = 7 * 24 * time.Hour
 	}
@@ -77,6 +100,53 @@ func (c *TGCollector) setDefaults() {
 	if c.Scrape.Interval <= 0 {
 		c.Scrape.Interval = 60 * time.Minute
 	}
+	if c.Scrape.DeletedCheck.Interval <= 0 {
+		c.Scrape.DeletedCheck.Interval = 30 * time.Minute
+	}
+	if c.Scrape.Media.Dir == "" {
+		c.Scrape.Media.Dir = "data/media"
+	}
+	if c.Scrape.Media.MaxFileBytes <= 0 {
+		c.Scrape.Media.MaxFileBytes = 20 << 20
+	}
+	if c.Scrape.Health.BackoffBase <= 0 {
+		c.Scrape.Health.BackoffBase = 30 * time.Minute
+	}
+	if c.Scrape.Health.BackoffMax <= 0 {
+		c.Scrape.Health.BackoffMax = 24 * time.Hour
+	}
+	if c.Scrape.Realtime.PollInterval <= 0 {
+		c.Scrape.Realtime.PollInterval = 6 * time.Hour
+	}
+	if c.Scrape.Backfill.ChunkSize <= 0 {
+		c.Scrape.Backfill.ChunkSize = 500
+	}
+	// backfill идет фоном, поэтому медленнее обычного обхода
+	if c.Scrape.Backfill.MinDelay <= 0 {
+		c.Scrape.Backfill.MinDelay = 2 * c.Scrape.MinDelay
+	}
+	if c.Scrape.Archive.Retention <= 0 {
+		c.Scrape.Archive.Retention = 30 * 24 * time.Hour
+	}
+	if c.Scrape.Stories.Window <= 0 {
+		c.Scrape.Stories.Window = 48 * time.Hour
+	}
+	if c.Scrape.Stories.MaxDistance <= 0 {
+		c.Scrape.Stories.MaxDistance = 3
+	}
+	if c.Scrape.Stories.MinWords <= 0 {
+		c.Scrape.Stories.MinWords = 8
+	}
+
+	if c.Retention.Interval <= 0 {
+		c.Retention.Interval = 24 * time.Hour
+	}
+	if c.Retention.Dir == "" {
+		c.Retention.Dir = "data/archive"
+	}
+	if c.Retention.BatchSize <= 0 {
+		c.Retention.BatchSize = 1000
+	}
 }
 
 func (c *TGCollector) Validate() error {
@@ -100,6 +170,9 @@ func (c *TGCollector) Validate() error {
 	if err := c.Scrape.Validate(); err != nil {
 		return fmt.Errorf("scrape: %w", err)
 	}
+	if err := c.Retention.Validate(); err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
 
 	return nil
 }
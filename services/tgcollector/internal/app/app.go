@@ -8,10 +8,14 @@ import (
 	"time"
 
 	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
 
 	platformpg "github.com/faringet/telegram-bot-scraper/internal/platform/postgres"
+	pcfg "github.com/faringet/telegram-bot-scraper/pkg/config"
 	tgcollector "github.com/faringet/telegram-bot-scraper/services/tgcollector/config"
 	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/retention"
 	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/scraper"
 	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
 )
@@ -20,9 +24,20 @@ type App struct {
 	cfg *tgcollector.TGCollector
 	log *slog.Logger
 
-	client  *mtclient.Client
+	pool    *mtclient.Pool
 	store   storage.Store
 	scraper *scraper.Scraper
+
+	// retention != nil только при retention.enabled
+	retention *retention.Retention
+
+	// updates != nil только при scrape.realtime.enabled
+	// crawlNow дергается, когда Telegram сообщает о дыре в потоке канала
+	updates  *updates.Manager
+	crawlNow chan struct{}
+
+	// backfillDone выставляется, когда история всех каналов догружена до since
+	backfillDone bool
 }
 
 func New(cfg *tgcollector.TGCollector, log *slog.Logger) (*App, error) {
@@ -38,32 +53,130 @@ func New(cfg *tgcollector.TGCollector, log *slog.Logger) (*App, error) {
 		slog.String("module", "collector.app"),
 	)
 
-	client, err := mtclient.New(cfg.MTProto, log)
-	if err != nil {
-		return nil, fmt.Errorf("create mtproto client: %w", err)
-	}
-
 	store, err := openStore(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("open store: %w", err)
 	}
 
-	s := scraper.New(scraper.Config{
+	s, err := scraper.New(scraper.Config{
 		Channels:             cfg.Scrape.Channels,
 		Keywords:             cfg.Scrape.Keywords,
+		KeywordMode:          cfg.Scrape.KeywordMode,
 		Lookback:             cfg.Scrape.Lookback,
 		PerChannelMaxScan:    cfg.Scrape.PerChannelMaxScan,
 		MinDelay:             cfg.Scrape.MinDelay,
 		BetweenChannelsDelay: cfg.Scrape.BetweenChannelsDelay,
+		EditWindow:           cfg.Scrape.EditWindow,
+		DeletedCheckWindow:   cfg.Scrape.DeletedCheck.Window,
+		DeletedCheckInterval: cfg.Scrape.DeletedCheck.Interval,
+		Media: scraper.MediaConfig{
+			Enabled:        cfg.Scrape.Media.Enabled,
+			Dir:            cfg.Scrape.Media.Dir,
+			MaxFileBytes:   cfg.Scrape.Media.MaxFileBytes,
+			RunBudgetBytes: cfg.Scrape.Media.RunBudgetBytes,
+		},
+		Archive:     cfg.Scrape.Archive.Enabled,
+		Concurrency: cfg.MTProto.RateLimit.Concurrency,
+		Health: scraper.HealthConfig{
+			QuarantineAfter: cfg.Scrape.Health.QuarantineAfter,
+			BackoffBase:     cfg.Scrape.Health.BackoffBase,
+			BackoffMax:      cfg.Scrape.Health.BackoffMax,
+		},
+		Groups: scrapeGroups(cfg.Scrape.Groups),
 	}, log, store)
+	if err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("create scraper: %w", err)
+	}
+
+	a := &App{
+		cfg:      cfg,
+		log:      log,
+		store:    store,
+		scraper:  s,
+		crawlNow: make(chan struct{}, 1),
+	}
+
+	if cfg.Retention.Enabled {
+		r, err := retention.New(retention.Config{
+			Window:    cfg.Scrape.DedupWindow,
+			Dir:       cfg.Retention.Dir,
+			BatchSize: cfg.Retention.BatchSize,
+		}, log, store)
+		if err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("create retention: %w", err)
+		}
+		a.retention = r
+	}
+
+	var handler telegram.UpdateHandler
+	if cfg.Scrape.Realtime.Enabled {
+		d := tg.NewUpdateDispatcher()
+		d.OnNewChannelMessage(s.HandleNewChannelMessage)
+		d.OnEditChannelMessage(s.HandleEditChannelMessage)
+		d.OnDeleteChannelMessages(s.HandleDeleteChannelMessages)
 
-	return &App{
-		cfg:     cfg,
-		log:     log,
-		client:  client,
-		store:   store,
-		scraper: s,
-	}, nil
+		a.updates = updates.New(updates.Config{
+			Handler:          d,
+			OnChannelTooLong: func(int64) { a.requestCrawl() },
+		})
+		handler = a.updates
+	}
+
+	pool, err := mtclient.NewPool(cfg.MTProto, store, log, handler)
+	if err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("create mtproto pool: %w", err)
+	}
+	a.pool = pool
+
+	return a, nil
+}
+
+// requestCrawl просит внеочередной обход, не блокируясь, если он уже запрошен
+func (a *App) requestCrawl() {
+	select {
+	case a.crawlNow <- struct{}{}:
+	default:
+	}
+}
+
+func scrapeGroups(in []pcfg.ScrapeGroup) []scraper.GroupConfig {
+	out := make([]scraper.GroupConfig, 0, len(in))
+	for _, g := range in {
+		out = append(out, scraper.GroupConfig{
+			Name:                 g.Name,
+			Channels:             g.Channels,
+			Keywords:             g.Keywords,
+			KeywordMode:          g.KeywordMode,
+			Lookback:             g.Lookback,
+			PerChannelMaxScan:    g.PerChannelMaxScan,
+			MinDelay:             g.MinDelay,
+			BetweenChannelsDelay: g.BetweenChannelsDelay,
+		})
+	}
+	return out
+}
+
+func registryFromConfig(c pcfg.Scrape) storage.Registry {
+	var r storage.Registry
+
+	add := func(group string, channels, keywords []string) {
+		for _, ch := range channels {
+			r.Channels = append(r.Channels, storage.RegistryItem{Value: ch, Group: group})
+		}
+		for _, kw := range keywords {
+			r.Keywords = append(r.Keywords, storage.RegistryItem{Value: kw, Group: group})
+		}
+	}
+
+	add(pcfg.DefaultScrapeGroup, c.Channels, c.Keywords)
+	for _, g := range c.Groups {
+		add(g.Name, g.Channels, g.Keywords)
+	}
+
+	return r
 }
 
 func openStore(cfg *tgcollector.TGCollector) (storage.Store, error) {
@@ -86,7 +199,16 @@ func openStore(cfg *tgcollector.TGCollector) (storage.Store, error) {
 		return nil, fmt.Errorf("open postgres db: %w", err)
 	}
 
-	st, err := storage.NewPostgres(db, cfg.Scrape.DedupWindow)
+	var stories storage.StoryConfig
+	if cfg.Scrape.Stories.Enabled {
+		stories = storage.StoryConfig{
+			Window:      cfg.Scrape.Stories.Window,
+			MaxDistance: cfg.Scrape.Stories.MaxDistance,
+			MinWords:    cfg.Scrape.Stories.MinWords,
+		}
+	}
+
+	st, err := storage.NewPostgres(db, stories)
 	if err != nil {
 		_ = db.Close()
 		return nil, fmt.Errorf("create postgres storage: %w", err)
@@ -110,14 +232,37 @@ func (a *App) Run(ctx context.Context) error {
 		slog.Int("max_idle_conns", a.cfg.Storage.Postgres.MaxIdleConns),
 	)
 
-	interval := a.cfg.Scrape.Interval
-	if interval <= 0 {
-		interval = 10 * time.Minute
+	baseInterval := a.cfg.Scrape.Interval
+	if baseInterval <= 0 {
+		baseInterval = 10 * time.Minute
+	}
+
+	// пустые channels / keywords заполняются из конфига, непустые не трогаются
+	channels, keywords, err := a.store.SeedRegistry(ctx, registryFromConfig(a.cfg.Scrape), "config")
+	if err != nil {
+		a.log.Error("seed registry failed", slog.Any("err", err))
+	} else if channels > 0 || keywords > 0 {
+		a.log.Info("registry seeded",
+			slog.Int("channels", channels),
+			slog.Int("keywords", keywords),
+		)
 	}
 
-	return a.client.WithClient(ctx, func(ctx context.Context, td *telegram.Client) error {
-		if err := a.scraper.Crawl(ctx, td); err != nil {
-			a.log.Error("initial crawl failed", slog.Any("err", err))
+	// retention работает только с БД, поэтому живет отдельно от аккаунтов
+	stopRetention := a.startRetention(ctx)
+	defer stopRetention()
+
+	return a.pool.Run(ctx, func(ctx context.Context) error {
+		streamErr := a.startUpdates(ctx)
+		interval := baseInterval
+
+		// при realtime обход нужен только как страховка от пропусков
+		// поэтому первый обход после старта добирает все, что пришло, пока нас не было
+		a.crawl(ctx, "initial")
+		a.backfillStep(ctx)
+
+		if streamErr != nil {
+			interval = a.cfg.Scrape.Realtime.PollInterval
 		}
 
 		t := time.NewTicker(interval)
@@ -129,11 +274,272 @@ func (a *App) Run(ctx context.Context) error {
 				a.log.Info("shutdown", slog.Any("err", ctx.Err()))
 				return ctx.Err()
 
+			case err := <-streamErr:
+				// поток упал, дальше живем обычным обходом
+				a.log.Error("updates stream stopped, fallback to polling",
+					slog.Any("err", err),
+					slog.Duration("interval", baseInterval),
+				)
+				streamErr = nil
+				interval = baseInterval
+				t.Reset(interval)
+				a.crawl(ctx, "fallback")
+
+			case <-a.crawlNow:
+				a.crawl(ctx, "gap")
+				a.backfillStep(ctx)
+
 			case <-t.C:
-				if err := a.scraper.Crawl(ctx, td); err != nil {
-					a.log.Error("scheduled crawl failed", slog.Any("err", err))
-				}
+				a.crawl(ctx, "scheduled")
+				a.backfillStep(ctx)
+			}
+		}
+	})
+}
+
+// crawl запускает обход и пишет в лог, сколько за него ушло на FLOOD_WAIT
+func (a *App) crawl(ctx context.Context, reason string) {
+	start := time.Now()
+	err := a.scraper.Crawl(ctx, a.pool)
+	st := a.pool.TakeRateStats()
+
+	if err != nil {
+		a.log.Error("crawl failed",
+			slog.String("reason", reason),
+			slog.Any("err", err),
+		)
+	}
+
+	a.log.Info("crawl stats",
+		slog.String("reason", reason),
+		slog.Duration("duration", time.Since(start)),
+		slog.Int("flood_waits", st.FloodWaits),
+		slog.Duration("flood_wait_total", st.Waited),
+		slog.Duration("request_delay", st.CurrentDelay),
+	)
+
+	a.pruneArchive(ctx)
+}
+
+// pruneArchive чистит архив сообщений старше scrape.archive.retention
+func (a *App) pruneArchive(ctx context.Context) {
+	if !a.cfg.Scrape.Archive.Enabled || a.cfg.Scrape.Archive.Retention <= 0 {
+		return
+	}
+
+	n, err := a.store.PruneMessages(ctx, time.Now().Add(-a.cfg.Scrape.Archive.Retention))
+	if err != nil {
+		a.log.Error("prune message archive failed", slog.Any("err", err))
+		return
+	}
+	if n > 0 {
+		a.log.Info("message archive pruned",
+			slog.Int("deleted", n),
+			slog.Duration("retention", a.cfg.Scrape.Archive.Retention),
+		)
+	}
+}
+
+func (a *App) backfillConfig() scraper.BackfillConfig {
+	b := a.cfg.Scrape.Backfill
+	return scraper.BackfillConfig{
+		Since:     b.SinceTime(),
+		ChunkSize: b.ChunkSize,
+		MinDelay:  b.MinDelay,
+		Notify:    b.Notify,
+	}
+}
+
+// maxBackfillStep это потолок одного шага backfill: шаг идет в основном цикле Run,
+// и пока он не кончился, сигналы о пропусках и падение потока обновлений ждут
+const maxBackfillStep = 2 * time.Minute
+
+// backfillStep догружает историю после обхода, если backfill включен
+// на него отводится половина scrape.interval, но не больше maxBackfillStep,
+// чтобы не задерживать следующий обход. От poll_interval не зависит: он бывает в часы
+func (a *App) backfillStep(ctx context.Context) {
+	if !a.cfg.Scrape.Backfill.Enabled || a.backfillDone {
+		return
+	}
+
+	budget := a.cfg.Scrape.Interval / 2
+	if budget <= 0 || budget > maxBackfillStep {
+		budget = maxBackfillStep
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	res, err := a.scraper.Backfill(stepCtx, a.pool, a.backfillConfig())
+	if err != nil {
+		if ctx.Err() == nil && !errors.Is(err, context.DeadlineExceeded) {
+			a.log.Error("backfill failed", slog.Any("err", err))
+		}
+		return
+	}
+	if res.Done() {
+		a.backfillDone = true
+		a.log.Info("backfill completed", slog.String("since", a.cfg.Scrape.Backfill.Since))
+	}
+}
+
+// RunBackfill это команда `tgcollector backfill`: гонит backfill до конца без обычного обхода
+// прерванный прогон продолжается со старого места при следующем запуске
+func (a *App) RunBackfill(ctx context.Context) error {
+	c := a.backfillConfig()
+	if c.Since.IsZero() {
+		return errors.New("collector app: scrape.backfill.since is required for backfill")
+	}
+
+	a.log.Info("backfill started",
+		slog.String("since", a.cfg.Scrape.Backfill.Since),
+		slog.Int("chunk_size", c.ChunkSize),
+		slog.Duration("min_delay", c.MinDelay),
+	)
+
+	return a.pool.Run(ctx, func(ctx context.Context) error {
+		for pass := 1; ; pass++ {
+			res, err := a.scraper.Backfill(ctx, a.pool, c)
+			if err != nil {
+				return fmt.Errorf("backfill pass %d: %w", pass, err)
+			}
+			if res.Done() {
+				a.log.Info("backfill completed", slog.Int("passes", pass))
+				return nil
+			}
+
+			// остались только упавшие каналы, крутиться по ним бесконечно смысла нет
+			if res.Pending == res.Failed {
+				return fmt.Errorf("collector app: backfill stopped, %d channels failed, see log", res.Failed)
+			}
+
+			if err := sleepCtx(ctx, a.cfg.Scrape.BetweenChannelsDelay); err != nil {
+				return err
 			}
 		}
 	})
 }
+
+// startRetention запускает retention раз в retention.interval, первый прогон сразу
+// возвращает функцию, которая останавливает его и дожидается текущего прогона
+func (a *App) startRetention(ctx context.Context) func() {
+	if a.retention == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(a.cfg.Retention.Interval)
+		defer t.Stop()
+
+		for {
+			if _, err := a.retention.Run(ctx); err != nil && ctx.Err() == nil {
+				a.log.Error("retention failed", slog.Any("err", err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// RunRematch это команда `tgcollector rematch`: прогоняет архив messages
+// через текущие выражения и сохраняет новые hits. Telegram для этого не нужен
+//
+// since = 0 значит весь архив
+func (a *App) RunRematch(ctx context.Context, since time.Duration, notify bool) error {
+	if !a.cfg.Scrape.Archive.Enabled {
+		a.log.Warn("scrape.archive is disabled, rematch works only with what was archived before")
+	}
+
+	c := scraper.RematchConfig{Notify: notify}
+	if since > 0 {
+		c.Since = time.Now().Add(-since)
+	}
+
+	a.log.Info("rematch started",
+		slog.Duration("since", since),
+		slog.Bool("notify", notify),
+	)
+
+	res, err := a.scraper.Rematch(ctx, c)
+	if err != nil {
+		return fmt.Errorf("rematch: %w", err)
+	}
+
+	a.log.Info("rematch completed",
+		slog.Int("scanned", res.Scanned),
+		slog.Int("hits_new", res.HitsNew),
+		slog.Int("no_group", res.NoGroup),
+	)
+	return nil
+}
+
+// startUpdates запускает менеджер обновлений в отдельной горутине
+// возвращает nil, если realtime выключен, иначе канал с ошибкой остановки потока
+//
+// поток слушает только первый аккаунт пула
+func (a *App) startUpdates(ctx context.Context) <-chan error {
+	if a.updates == nil {
+		return nil
+	}
+
+	primary := a.pool.Primary()
+	if primary == nil {
+		errCh := make(chan error, 1)
+		errCh <- errors.New("primary mtproto account is not running")
+		return errCh
+	}
+	td := primary.TD()
+
+	a.scraper.AttachRealtimeAccount(primary)
+
+	self, err := td.Self(ctx)
+	if err != nil {
+		errCh := make(chan error, 1)
+		errCh <- fmt.Errorf("get self: %w", err)
+		return errCh
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		err := a.updates.Run(ctx, td.API(), self.ID, updates.AuthOptions{
+			OnStart: func(ctx context.Context) {
+				a.log.Info("updates stream started",
+					slog.Duration("poll_interval", a.cfg.Scrape.Realtime.PollInterval),
+				)
+			},
+		})
+		if err != nil && ctx.Err() == nil {
+			errCh <- err
+		}
+	}()
+	return errCh
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
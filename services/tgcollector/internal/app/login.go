@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	pcfg "github.com/faringet/telegram-bot-scraper/pkg/config"
+	tgcollector "github.com/faringet/telegram-bot-scraper/services/tgcollector/config"
+	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
+)
+
+// Login это команда `tgcollector login [аккаунт]`: входит в аккаунты пула по очереди
+// и записывает их сессии. App не создается: Postgres нужен, только если сессии лежат в нем
+func Login(ctx context.Context, cfg *tgcollector.TGCollector, log *slog.Logger, account string) error {
+	if cfg == nil {
+		return errors.New("collector app: config is nil")
+	}
+	if log == nil {
+		return errors.New("collector app: logger is nil")
+	}
+
+	var sessions mtclient.SessionStore
+	if cfg.MTProto.SessionStore.Driver == pcfg.SessionStorePostgres {
+		store, err := openStore(cfg)
+		if err != nil {
+			return fmt.Errorf("open store: %w", err)
+		}
+		defer func() { _ = store.Close() }()
+		sessions = store
+	}
+
+	found := false
+	for _, a := range cfg.MTProto.AccountList() {
+		if account != "" && a.Name != account {
+			continue
+		}
+		found = true
+
+		if err := mtclient.Login(ctx, a.Name, cfg.MTProto.ForAccount(a), sessions, log, os.Stdout); err != nil {
+			return fmt.Errorf("login account %s: %w", a.Name, err)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("collector app: unknown mtproto account %q", account)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package keywords
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokRegex
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// mode задан явно префиксом stem:/exact:/substr:, пусто если не задан
+	mode Mode
+}
+
+// tokenize режет выражение на токены
+//
+// операторы AND/OR/NOT распознаются только капсом, чтобы обычные
+// ключевые слова вроде "rock and roll" не превращались в выражения
+func tokenize(src string) ([]token, error) {
+	out := make([]token, 0, 8)
+
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '(':
+			out = append(out, token{kind: tokLParen})
+			i += size
+
+		case r == ')':
+			out = append(out, token{kind: tokRParen})
+			i += size
+
+		case r == '"':
+			value, n, err := readPhrase(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("phrase at %d: %w", i, err)
+			}
+			out = append(out, token{kind: tokPhrase, value: value})
+			i += n
+
+		case r == '/':
+			value, n, err := readRegex(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("regex at %d: %w", i, err)
+			}
+			out = append(out, token{kind: tokRegex, value: value})
+			i += n
+
+		default:
+			j := i
+			for j < len(src) {
+				r, size := utf8.DecodeRuneInString(src[j:])
+				if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+					break
+				}
+				j += size
+			}
+
+			word := src[i:j]
+
+			if mode, rest := splitModePrefix(word); mode != "" {
+				if rest == "" && j < len(src) && src[j] == '"' {
+					value, n, err := readPhrase(src[j:])
+					if err != nil {
+						return nil, fmt.Errorf("phrase at %d: %w", j, err)
+					}
+					out = append(out, token{kind: tokPhrase, value: value, mode: mode})
+					i = j + n
+					continue
+				}
+				if rest == "" {
+					return nil, fmt.Errorf("empty term after %q at %d", word, i)
+				}
+				out = append(out, token{kind: tokWord, value: rest, mode: mode})
+				i = j
+				continue
+			}
+
+			switch word {
+			case "AND":
+				out = append(out, token{kind: tokAnd})
+			case "OR":
+				out = append(out, token{kind: tokOr})
+			case "NOT":
+				out = append(out, token{kind: tokNot})
+			default:
+				out = append(out, token{kind: tokWord, value: word})
+			}
+			i = j
+		}
+	}
+
+	return out, nil
+}
+
+// readPhrase читает "фразу" начиная с открывающей кавычки
+func readPhrase(s string) (string, int, error) {
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return "", 0, fmt.Errorf("unterminated quote")
+	}
+	return s[1 : 1+end], end + 2, nil
+}
+
+// readRegex читает /pattern/ начиная с открывающего слеша
+// внутри паттерна слеш экранируется как \/
+func readRegex(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '/' {
+			b.WriteByte('/')
+			i++
+			continue
+		}
+		if c == '/' {
+			if b.Len() == 0 {
+				return "", 0, fmt.Errorf("empty pattern")
+			}
+			return b.String(), i + 1, nil
+		}
+		b.WriteByte(c)
+	}
+	return "", 0, fmt.Errorf("unterminated pattern")
+}
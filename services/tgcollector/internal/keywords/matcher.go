@@ -0,0 +1,152 @@
+package keywords
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Matcher хранит скомпилированные ключевые выражения
+// компилируется один раз при старте, потом только Match на каждое сообщение
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	source string
+	expr   node
+}
+
+// ExprPrefix включает разбор строки как выражения
+const ExprPrefix = "expr:"
+
+// Compile собирает Matcher из списка выражений
+//
+// строка без ExprPrefix это обычное ключевое слово, целиком и как есть:
+// ищется в defaultMode, по умолчанию подстрокой без учета регистра, как и раньше.
+// Кавычки, скобки, слеши и AND/OR/NOT в нем ничего не значат. С префиксом разбирается выражение:
+//
+//	expr:сбер AND (увольнение OR назначение) NOT вакансия
+//	expr:"ai" OR /gpt-?\d/
+//	expr:stem:уволить AND exact:"газпром нефть"
+//
+// "фраза" ищется по границам слов, /.../ это регулярка без учета регистра,
+// префикс stem:/exact:/substr: задает режим для конкретного терма.
+// Выражение, которое срабатывает и без найденного терма (expr:NOT вакансия), это ошибка.
+// Дубли отбрасываются, обычные слова сравниваются без учета регистра
+func Compile(exprs []string, defaultMode Mode) (*Matcher, error) {
+	if defaultMode == "" {
+		defaultMode = ModeSubstring
+	}
+
+	m := &Matcher{rules: make([]rule, 0, len(exprs))}
+	seen := map[string]struct{}{}
+
+	for _, src := range exprs {
+		src = strings.TrimSpace(src)
+		if src == "" {
+			continue
+		}
+
+		var (
+			expr node
+			key  string
+			err  error
+		)
+		if body, ok := cutExprPrefix(src); ok {
+			tokens, err := tokenize(body)
+			if err != nil {
+				return nil, fmt.Errorf("keywords: %q: %w", src, err)
+			}
+			if expr, err = parse(tokens, defaultMode); err != nil {
+				return nil, fmt.Errorf("keywords: %q: %w", src, err)
+			}
+			if !positive(expr) {
+				return nil, fmt.Errorf("keywords: %q: expression matches without any term, add a term outside NOT", src)
+			}
+			src, key = body, ExprPrefix+body
+		} else {
+			src = strings.ToLower(src)
+			if expr, err = newTerm(src, defaultMode); err != nil {
+				return nil, fmt.Errorf("keywords: %q: %w", src, err)
+			}
+			key = src
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		m.rules = append(m.rules, rule{source: src, expr: expr})
+	}
+
+	if len(m.rules) == 0 {
+		return nil, errors.New("keywords: no expressions")
+	}
+
+	return m, nil
+}
+
+// cutExprPrefix отрезает ExprPrefix (в любом регистре), ok = false если его нет
+func cutExprPrefix(src string) (string, bool) {
+	if len(src) < len(ExprPrefix) || !strings.EqualFold(src[:len(ExprPrefix)], ExprPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(src[len(ExprPrefix):]), true
+}
+
+// Match это одно сработавшее выражение и позиции его термов в тексте
+type Match struct {
+	Keyword string
+	Spans   []Span
+}
+
+// MatchAll возвращает все сработавшие выражения в порядке из конфига
+func (m *Matcher) MatchAll(text string) []Match {
+	if m == nil || text == "" {
+		return nil
+	}
+
+	s := newSubject(text)
+	var out []Match
+	for _, r := range m.rules {
+		spans, ok := r.expr.match(s)
+		if !ok {
+			continue
+		}
+		out = append(out, Match{Keyword: r.source, Spans: normalizeSpans(spans)})
+	}
+	return out
+}
+
+func (m *Matcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.rules)
+}
+
+// normalizeSpans сортирует позиции и выкидывает дубли,
+// которые появляются когда один терм встречается в выражении дважды
+func normalizeSpans(in []Span) []Span {
+	if len(in) < 2 {
+		return in
+	}
+
+	sort.Slice(in, func(i, j int) bool {
+		if in[i].Start != in[j].Start {
+			return in[i].Start < in[j].Start
+		}
+		return in[i].End < in[j].End
+	})
+
+	out := in[:1]
+	for _, sp := range in[1:] {
+		if sp != out[len(out)-1] {
+			out = append(out, sp)
+		}
+	}
+	return out
+}
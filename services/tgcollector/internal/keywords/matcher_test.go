@@ -0,0 +1,152 @@
+package keywords
+
+import (
+	"testing"
+)
+
+func TestCompilePlainKeywordsStayLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyword string
+		text    string
+		want    bool
+	}{
+		{name: "substring inside word", keyword: "ai", text: "пишите на email", want: true},
+		{name: "case insensitive", keyword: "Сбер", text: "СБЕР отчитался", want: true},
+		{name: "quotes are literal", keyword: `"ai"`, text: `модель "ai" вышла`, want: true},
+		{name: "quotes are not a phrase", keyword: `"ai"`, text: "модель ai вышла", want: false},
+		{name: "slashes are literal", keyword: "/gpt/", text: "путь /gpt/ в урле", want: true},
+		{name: "slashes are not a regex", keyword: "/gpt-?4/", text: "вышел gpt-4", want: false},
+		{name: "parentheses are literal", keyword: "(сбер)", text: "банк (сбер) вырос", want: true},
+		{name: "parentheses are not grouping", keyword: "(сбер)", text: "сбер вырос", want: false},
+		{name: "uppercase AND is literal", keyword: "Rock AND Roll", text: "rock and roll жив", want: true},
+		{name: "uppercase AND is not an operator", keyword: "Rock AND Roll", text: "rock жив, roll тоже", want: false},
+		{name: "uppercase NOT is literal", keyword: "NOT вакансия", text: "это not вакансия", want: true},
+		{name: "uppercase NOT does not negate", keyword: "NOT вакансия", text: "новости банка", want: false},
+		{name: "mode prefix is literal", keyword: "stem:уволить", text: "уволили директора", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Compile([]string{tt.keyword}, ModeSubstring)
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.keyword, err)
+			}
+			if got := len(m.MatchAll(tt.text)) > 0; got != tt.want {
+				t.Fatalf("Compile(%q).MatchAll(%q) matched = %v, want %v", tt.keyword, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompilePlainKeywordSource(t *testing.T) {
+	m, err := Compile([]string{"Сбер", "сбер", " СБЕР ", `"AI"`}, ModeSubstring)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2: plain keywords dedup without case", m.Len())
+	}
+
+	got := m.MatchAll(`сбер и "ai"`)
+	if len(got) != 2 || got[0].Keyword != "сбер" || got[1].Keyword != `"ai"` {
+		t.Fatalf("MatchAll keywords = %+v, want сбер and \"ai\" lowercased", got)
+	}
+	if want := (Span{Start: 0, End: 4}); len(got[0].Spans) != 1 || got[0].Spans[0] != want {
+		t.Fatalf("spans = %+v, want [%+v]", got[0].Spans, want)
+	}
+}
+
+func TestCompileExpressions(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		text string
+		want bool
+	}{
+		{name: "OR binds weaker than AND, left", expr: "expr:a OR b AND c", text: "только a", want: true},
+		{name: "OR binds weaker than AND, right only half", expr: "expr:a OR b AND c", text: "только b", want: false},
+		{name: "OR binds weaker than AND, right", expr: "expr:a OR b AND c", text: "b и c", want: true},
+		{name: "parentheses group", expr: "expr:(a OR b) AND c", text: "только a", want: false},
+		{name: "parentheses group, match", expr: "expr:(a OR b) AND c", text: "b и c", want: true},
+		{name: "A NOT B without B", expr: "expr:сбер NOT вакансия", text: "сбер назначил главу", want: true},
+		{name: "A NOT B with B", expr: "expr:сбер NOT вакансия", text: "сбер открыл вакансия", want: false},
+		{name: "A AND NOT B", expr: "expr:сбер AND NOT вакансия", text: "сбер открыл вакансия", want: false},
+		{name: "NOT binds tighter than OR", expr: "expr:a NOT b OR c", text: "b и c", want: true},
+		{name: "implicit AND between terms", expr: `expr:"сбер" /gpt/`, text: "сбер выпустил gpt", want: true},
+		{name: "implicit AND needs both", expr: `expr:"сбер" /gpt/`, text: "сбер выпустил модель", want: false},
+		{name: "adjacent words are one term", expr: "expr:газпром нефть", text: "нефть и газпром", want: false},
+		{name: "adjacent words, match", expr: "expr:газпром нефть", text: "акции газпром нефть", want: true},
+		{name: "lowercase and is a word", expr: "expr:rock and roll", text: "rock and roll", want: true},
+		{name: "phrase is whole word", expr: `expr:"ai"`, text: "пишите на email", want: false},
+		{name: "phrase, match", expr: `expr:"ai"`, text: "новости про AI.", want: true},
+		{name: "phrase keeps spaces", expr: `expr:"газпром нефть"`, text: "Газпром Нефть отчиталась", want: true},
+		{name: "regex is case insensitive", expr: `expr:/gpt-?\d/`, text: "вышел GPT4", want: true},
+		{name: "regex, dash", expr: `expr:/gpt-?\d/`, text: "вышел gpt-5", want: true},
+		{name: "regex, no match", expr: `expr:/gpt-?\d/`, text: "вышел gpt", want: false},
+		{name: "regex escaped slash", expr: `expr:/a\/b/`, text: "путь a/b", want: true},
+		{name: "exact mode prefix", expr: "expr:exact:ai", text: "пишите на email", want: false},
+		{name: "substr mode prefix", expr: `expr:substr:"ai"`, text: "пишите на email", want: true},
+		{name: "stem mode prefix", expr: "expr:stem:уволить", text: "директора уволили вчера", want: true},
+		{name: "prefix in any case", expr: "EXPR:a OR b", text: "только b", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Compile([]string{tt.expr}, ModeSubstring)
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.expr, err)
+			}
+			if got := len(m.MatchAll(tt.text)) > 0; got != tt.want {
+				t.Fatalf("Compile(%q).MatchAll(%q) matched = %v, want %v", tt.expr, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionSource(t *testing.T) {
+	m, err := Compile([]string{"expr:сбер NOT вакансия", "expr: сбер NOT вакансия", "сбер NOT вакансия"}, ModeSubstring)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2: same expression dedups, plain keyword is separate", m.Len())
+	}
+
+	got := m.MatchAll("сбер сегодня")
+	if len(got) != 1 || got[0].Keyword != "сбер NOT вакансия" {
+		t.Fatalf("MatchAll = %+v, want the expression body without prefix", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		exprs []string
+	}{
+		{name: "no keywords", exprs: nil},
+		{name: "only blanks", exprs: []string{"", "  "}},
+		{name: "empty expression", exprs: []string{"expr:"}},
+		{name: "unterminated quote", exprs: []string{`expr:"сбер`}},
+		{name: "unterminated regex", exprs: []string{"expr:/gpt"}},
+		{name: "empty regex", exprs: []string{"expr://"}},
+		{name: "bad regex", exprs: []string{"expr:/[/"}},
+		{name: "missing closing parenthesis", exprs: []string{"expr:(a OR b"}},
+		{name: "stray closing parenthesis", exprs: []string{"expr:a OR b)"}},
+		{name: "dangling operator", exprs: []string{"expr:a OR"}},
+		{name: "leading operator", exprs: []string{"expr:AND a"}},
+		{name: "empty mode term", exprs: []string{"expr:stem: AND a"}},
+		{name: "only NOT", exprs: []string{"expr:NOT вакансия"}},
+		{name: "NOT in parentheses", exprs: []string{"expr:(NOT a) AND NOT b"}},
+		{name: "OR with NOT", exprs: []string{"expr:сбер OR NOT вакансия"}},
+		{name: "one bad among good", exprs: []string{"сбер", "expr:(a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.exprs, ModeSubstring); err == nil {
+				t.Fatalf("Compile(%q) = nil error, want error", tt.exprs)
+			}
+		})
+	}
+}
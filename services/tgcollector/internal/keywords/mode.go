@@ -0,0 +1,114 @@
+package keywords
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/faringet/telegram-bot-scraper/internal/platform/searchtext"
+)
+
+// Mode это способ сравнения терма с текстом
+type Mode string
+
+const (
+	// ModeSubstring ищет подстроку без учета регистра, "ai" найдется и в "email"
+	ModeSubstring Mode = "substring"
+	// ModeExact ищет по границам слов
+	ModeExact Mode = "exact"
+	// ModeStem сравнивает основы слов (Snowball), "уволили" найдется по "уволить"
+	ModeStem Mode = "stem"
+)
+
+// minStemRunes защищает от слишком коротких основ: если основа короче,
+// слово сравнивается целиком, иначе "ии" превратится в "и" и будет везде
+const minStemRunes = 3
+
+// modePrefixes это переключатели режима прямо в выражении:
+// stem:увольнение, exact:"ai", substr:газпром
+var modePrefixes = map[string]Mode{
+	"stem:":   ModeStem,
+	"exact:":  ModeExact,
+	"substr:": ModeSubstring,
+}
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeSubstring:
+		return ModeSubstring, nil
+	case ModeExact:
+		return ModeExact, nil
+	case ModeStem:
+		return ModeStem, nil
+	default:
+		return "", fmt.Errorf("keywords: unknown mode %q (want substring, exact or stem)", s)
+	}
+}
+
+func splitModePrefix(word string) (Mode, string) {
+	for prefix, mode := range modePrefixes {
+		if strings.HasPrefix(word, prefix) {
+			return mode, word[len(prefix):]
+		}
+	}
+	return "", word
+}
+
+func newTerm(value string, mode Mode) (node, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("empty %s term", mode)
+	}
+
+	switch mode {
+	case ModeExact:
+		return termNode{value: strings.ToLower(value), wholeWord: true}, nil
+
+	case ModeStem:
+		words := searchtext.Words(value)
+		if len(words) == 0 {
+			return nil, fmt.Errorf("stem term %q has no words", value)
+		}
+		stems := make([]string, 0, len(words))
+		for _, w := range words {
+			stems = append(stems, stemWord(w.Text))
+		}
+		return stemNode{stems: stems}, nil
+
+	default:
+		return termNode{value: strings.ToLower(value)}, nil
+	}
+}
+
+func stemWord(w string) string {
+	st := searchtext.Stem(w)
+	if utf8.RuneCountInString(st) < minStemRunes {
+		return w
+	}
+	return st
+}
+
+// stemNode ищет в тексте подряд идущие слова с такими же основами
+type stemNode struct {
+	stems []string
+}
+
+func (n stemNode) match(s *subject) ([]Span, bool) {
+	words := s.stemmedWords()
+
+	var spans []Span
+	for i := 0; i+len(n.stems) <= len(words); i++ {
+		ok := true
+		for j, st := range n.stems {
+			if words[i+j].Text != st {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			spans = append(spans, Span{Start: words[i].Start, End: words[i+len(n.stems)-1].End})
+		}
+	}
+
+	return spans, len(spans) > 0
+}
@@ -0,0 +1,177 @@
+package keywords
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/faringet/telegram-bot-scraper/internal/platform/searchtext"
+)
+
+// Span это позиция совпадения в тексте сообщения, в рунах, End не включительно
+type Span struct {
+	Start int
+	End   int
+}
+
+// subject это текст сообщения, подготовленный один раз на все правила
+//
+// strings.ToLower меняет регистр по рунам, так что рунные позиции
+// в lower и raw совпадают, байтовые могут отличаться
+type subject struct {
+	raw   string
+	lower string
+
+	// stems считаются лениво, только если в правилах есть stem-термы
+	stems []searchtext.Word
+}
+
+func newSubject(text string) *subject {
+	return &subject{raw: text, lower: strings.ToLower(text)}
+}
+
+func (s *subject) stemmedWords() []searchtext.Word {
+	if s.stems == nil {
+		words := searchtext.Words(s.raw)
+		for i := range words {
+			words[i].Text = stemWord(words[i].Text)
+		}
+		s.stems = words
+	}
+	return s.stems
+}
+
+type node interface {
+	// match возвращает сработал ли узел и позиции найденных термов
+	// у NOT позиций нет, он только отсекает
+	match(s *subject) ([]Span, bool)
+}
+
+type termNode struct {
+	value     string
+	wholeWord bool
+}
+
+func (n termNode) match(s *subject) ([]Span, bool) {
+	var spans []Span
+
+	for from := 0; from < len(s.lower); {
+		idx := strings.Index(s.lower[from:], n.value)
+		if idx < 0 {
+			break
+		}
+		start := from + idx
+		end := start + len(n.value)
+
+		if !n.wholeWord || isBoundary(s.lower, start, end) {
+			spans = append(spans, runeSpan(s.lower, start, end))
+			from = end
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(s.lower[start:])
+		from = start + size
+	}
+
+	return spans, len(spans) > 0
+}
+
+type regexNode struct {
+	re *regexp.Regexp
+}
+
+func (n regexNode) match(s *subject) ([]Span, bool) {
+	locs := n.re.FindAllStringIndex(s.raw, -1)
+	if len(locs) == 0 {
+		return nil, false
+	}
+
+	spans := make([]Span, 0, len(locs))
+	for _, loc := range locs {
+		spans = append(spans, runeSpan(s.raw, loc[0], loc[1]))
+	}
+	return spans, true
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) match(s *subject) ([]Span, bool) {
+	l, ok := n.left.match(s)
+	if !ok {
+		return nil, false
+	}
+	r, ok := n.right.match(s)
+	if !ok {
+		return nil, false
+	}
+	return append(l, r...), true
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) match(s *subject) ([]Span, bool) {
+	l, lok := n.left.match(s)
+	r, rok := n.right.match(s)
+	if !lok && !rok {
+		return nil, false
+	}
+	return append(l, r...), true
+}
+
+type notNode struct {
+	inner node
+}
+
+func (n notNode) match(s *subject) ([]Span, bool) {
+	_, ok := n.inner.match(s)
+	return nil, !ok
+}
+
+// positive проверяет, что узел срабатывает только при найденном терме
+//
+// "NOT вакансия" или "сбер OR NOT вакансия" срабатывают почти на любом сообщении,
+// такие выражения завалили бы hits, поэтому Compile их не принимает
+func positive(n node) bool {
+	switch n := n.(type) {
+	case notNode:
+		return false
+	case andNode:
+		return positive(n.left) || positive(n.right)
+	case orNode:
+		return positive(n.left) && positive(n.right)
+	default:
+		return true
+	}
+}
+
+// isBoundary проверяет что совпадение [start, end) не зажато буквами или цифрами
+// чтобы "ai" не находился внутри "email"
+func isBoundary(s string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func runeSpan(s string, start, end int) Span {
+	first := utf8.RuneCountInString(s[:start])
+	return Span{Start: first, End: first + utf8.RuneCountInString(s[start:end])}
+}
@@ -0,0 +1,164 @@
+package keywords
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Грамматика:
+//
+//	expr    := and { OR and }
+//	and     := unary { [AND] unary }
+//	unary   := NOT unary | primary
+//	primary := "(" expr ")" | [режим:]"фраза" | /regex/ | [режим:]слово { слово }
+//
+// Подряд идущие слова без оператора склеиваются в один терм,
+// как это было с обычными ключевыми словами. "A NOT B" читается как A AND NOT B
+//
+// Слова без префикса режима сравниваются в defaultMode, фразы в кавычках в ModeExact
+type parser struct {
+	tokens      []token
+	pos         int
+	defaultMode Mode
+}
+
+func parse(tokens []token, defaultMode Mode) (node, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+
+	p := &parser{tokens: tokens, defaultMode: defaultMode}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token at position %d", p.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokOr {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokOr || t.kind == tokRParen {
+			return left, nil
+		}
+		if t.kind == tokAnd {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t, ok := p.peek()
+	if ok && t.kind == tokNot {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	switch t.kind {
+	case tokLParen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		t, ok := p.peek()
+		if !ok || t.kind != tokRParen {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+
+	case tokPhrase:
+		p.pos++
+		mode := t.mode
+		if mode == "" {
+			mode = ModeExact
+		}
+		return newTerm(t.value, mode)
+
+	case tokRegex:
+		p.pos++
+		re, err := regexp.Compile("(?i)" + t.value)
+		if err != nil {
+			return nil, fmt.Errorf("compile regex: %w", err)
+		}
+		return regexNode{re: re}, nil
+
+	case tokWord:
+		mode := t.mode
+		if mode == "" {
+			mode = p.defaultMode
+		}
+
+		words := []string{t.value}
+		p.pos++
+		for {
+			t, ok := p.peek()
+			if !ok || t.kind != tokWord || t.mode != "" {
+				break
+			}
+			words = append(words, t.value)
+			p.pos++
+		}
+		return newTerm(strings.Join(words, " "), mode)
+
+	default:
+		return nil, fmt.Errorf("unexpected operator at position %d", p.pos)
+	}
+}
@@ -21,9 +21,19 @@ func authorizeIfNeeded(ctx context.Context, td *telegram.Client, c cfg.MTProto,
 		return errors.New("mtproto: telegram client is nil")
 	}
 
+	// с живой сессией телефон не нужен: аккаунт, залогиненный через `tgcollector login`,
+	// не обязан держать mtproto.phone в конфиге
+	status, err := td.Auth().Status(ctx)
+	if err != nil {
+		return fmt.Errorf("mtproto auth status: %w", err)
+	}
+	if status.Authorized {
+		return nil
+	}
+
 	phone := strings.TrimSpace(c.Phone)
 	if phone == "" && !c.AllowInteractiveAuth {
-		return errors.New("mtproto: phone is required when interactive auth is disabled")
+		return errors.New("mtproto: phone is required when interactive auth is disabled; create the session with `tgcollector login`")
 	}
 	if phone == "" {
 		phone = readLine("Enter phone: ")
@@ -36,7 +46,7 @@ func authorizeIfNeeded(ctx context.Context, td *telegram.Client, c cfg.MTProto,
 		_ = sent
 
 		if !c.AllowInteractiveAuth {
-			return "", errors.New("mtproto: interactive auth is disabled; bootstrap session first")
+			return "", errors.New("mtproto: interactive auth is disabled; create the session with `tgcollector login`")
 		}
 
 		code := readLine("Enter code: ")
@@ -55,7 +65,7 @@ func authorizeIfNeeded(ctx context.Context, td *telegram.Client, c cfg.MTProto,
 
 	flow := auth.NewFlow(ua, auth.SendCodeOptions{})
 
-	if err := td.Auth().IfNecessary(ctx, flow); err != nil {
+	if err := flow.Run(ctx, td.Auth()); err != nil {
 		if errors.Is(err, auth.ErrPasswordNotProvided) {
 			return errors.New("mtproto: 2FA password required; set mtproto.password and retry")
 		}
@@ -12,12 +12,15 @@ import (
 )
 
 type Client struct {
-	cfg cfg.MTProto
-	log *slog.Logger
-	td  *telegram.Client
+	cfg     cfg.MTProto
+	log     *slog.Logger
+	td      *telegram.Client
+	limiter *rateLimiter
 }
 
-func New(c cfg.MTProto, logg *slog.Logger) (*Client, error) {
+// New создает клиента. updates может быть nil, тогда обновления от Telegram не слушаем
+// sess nil значит сессия в файле mtproto.session
+func New(c cfg.MTProto, sess session.Storage, logg *slog.Logger, updates telegram.UpdateHandler) (*Client, error) {
 	if logg == nil {
 		logg = slog.Default()
 	}
@@ -30,18 +33,33 @@ func New(c cfg.MTProto, logg *slog.Logger) (*Client, error) {
 		return nil, fmt.Errorf("mtproto config: %w", err)
 	}
 
-	td, err := newTelegramClient(c)
+	limiter := newRateLimiter(c.RateLimit, logg)
+
+	if sess == nil {
+		sess = &session.FileStorage{Path: c.Session}
+	}
+
+	td, err := newTelegramClient(c, sess, updates, limiter)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Client{
-		cfg: c,
-		log: logg,
-		td:  td,
+		cfg:     c,
+		log:     logg,
+		td:      td,
+		limiter: limiter,
 	}, nil
 }
 
+// TakeRateStats отдает статистику FLOOD_WAIT с прошлого вызова и обнуляет ее
+func (c *Client) TakeRateStats() RateStats {
+	if c == nil || c.limiter == nil {
+		return RateStats{}
+	}
+	return c.limiter.takeStats()
+}
+
 func (c *Client) WithClient(ctx context.Context, fn func(ctx context.Context, td *telegram.Client) error) error {
 	if c == nil || c.td == nil {
 		return errors.New("mtproto: client is nil")
@@ -55,9 +73,7 @@ func (c *Client) WithClient(ctx context.Context, fn func(ctx context.Context, td
 	})
 }
 
-func newTelegramClient(c cfg.MTProto) (*telegram.Client, error) {
-	storage := &session.FileStorage{Path: c.Session}
-
+func newTelegramClient(c cfg.MTProto, storage session.Storage, updates telegram.UpdateHandler, limiter telegram.Middleware) (*telegram.Client, error) {
 	device := telegram.DeviceConfig{
 		DeviceModel:    c.Device.Model,
 		SystemVersion:  c.Device.System,
@@ -69,6 +85,8 @@ func newTelegramClient(c cfg.MTProto) (*telegram.Client, error) {
 	td := telegram.NewClient(c.APIID, c.APIHash, telegram.Options{
 		SessionStorage: storage,
 		Device:         device,
+		UpdateHandler:  updates,
+		Middlewares:    []telegram.Middleware{limiter},
 	})
 
 	return td, nil
@@ -0,0 +1,226 @@
+package mtproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"rsc.io/qr"
+
+	cfg "github.com/faringet/telegram-bot-scraper/pkg/config"
+)
+
+// Login это вход в один аккаунт для команды `tgcollector login`
+// создает сессию (файл или строку в mtproto_sessions) и выходит, уже авторизованную сессию не трогает
+//
+// в отличие от authorizeIfNeeded stdin не нужен: QR рисуется в out,
+// а код и пароль 2FA приходят через форму или файл из mtproto.login
+func Login(ctx context.Context, account string, c cfg.MTProto, sessions SessionStore, logg *slog.Logger, out io.Writer) error {
+	if logg == nil {
+		logg = slog.Default()
+	}
+	logg = logg.With(
+		slog.String("layer", "transport"),
+		slog.String("module", "collector.mtproto.login"),
+		slog.String("account", account),
+	)
+
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("mtproto config: %w", err)
+	}
+	if err := c.Login.Validate(); err != nil {
+		return fmt.Errorf("mtproto config: %w", err)
+	}
+
+	if c.SessionStore.Driver != cfg.SessionStorePostgres {
+		if err := os.MkdirAll(filepath.Dir(c.Session), 0o700); err != nil {
+			return fmt.Errorf("mtproto login: session dir: %w", err)
+		}
+	}
+	sess, err := openSession(account, c, sessions, logg)
+	if err != nil {
+		return err
+	}
+
+	// о том, что QR отсканировали, Telegram сообщает через updateLoginToken
+	d := tg.NewUpdateDispatcher()
+	loggedIn := qrlogin.OnLoginToken(d)
+
+	td, err := newTelegramClient(c, sess, d, newRateLimiter(c.RateLimit, logg))
+	if err != nil {
+		return err
+	}
+
+	if c.Login.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Login.Timeout)
+		defer cancel()
+	}
+
+	return td.Run(ctx, func(ctx context.Context) error {
+		st, err := td.Auth().Status(ctx)
+		if err != nil {
+			return fmt.Errorf("mtproto login: auth status: %w", err)
+		}
+		if st.Authorized {
+			logg.Info("session already authorized",
+				slog.String("session", c.Session),
+				slog.Int64("user_id", st.User.ID),
+			)
+			return nil
+		}
+
+		p, err := newPrompter(account, c, logg)
+		if err != nil {
+			return err
+		}
+		defer p.close()
+
+		if c.Login.Method == cfg.MTProtoLoginQR {
+			err = loginQR(ctx, td, loggedIn, p, c.Password, out, logg)
+		} else {
+			err = loginCode(ctx, td, p, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		self, err := td.Self(ctx)
+		if err != nil {
+			return fmt.Errorf("mtproto login: get self: %w", err)
+		}
+
+		logg.Info("mtproto login done",
+			slog.String("session", c.Session),
+			slog.String("method", c.Login.Method),
+			slog.Int64("user_id", self.ID),
+			slog.String("username", self.Username),
+		)
+		return nil
+	})
+}
+
+func loginQR(ctx context.Context, td *telegram.Client, loggedIn qrlogin.LoggedIn, p prompter, password string, out io.Writer, log *slog.Logger) error {
+	// show вызывается заново каждый раз, когда токен истекает (примерно раз в 30 секунд)
+	_, err := td.QR().Auth(ctx, loggedIn, func(ctx context.Context, token qrlogin.Token) error {
+		log.Info("scan the QR code: Telegram -> Settings -> Devices -> Link Desktop Device",
+			slog.Time("expires", token.Expires()),
+		)
+		return printQR(out, token.URL())
+	})
+	if err == nil {
+		return nil
+	}
+	if !tgerr.Is(err, "SESSION_PASSWORD_NEEDED") {
+		return fmt.Errorf("mtproto login: qr: %w", err)
+	}
+
+	if strings.TrimSpace(password) == "" {
+		if password, err = p.ask(ctx, fieldPassword); err != nil {
+			return err
+		}
+	}
+	if _, err := td.Auth().Password(ctx, password); err != nil {
+		return fmt.Errorf("mtproto login: 2FA password: %w", err)
+	}
+	return nil
+}
+
+func loginCode(ctx context.Context, td *telegram.Client, p prompter, c cfg.MTProto) error {
+	flow := auth.NewFlow(promptAuth{
+		p:        p,
+		phone:    strings.TrimSpace(c.Phone),
+		password: strings.TrimSpace(c.Password),
+	}, auth.SendCodeOptions{})
+
+	if err := flow.Run(ctx, td.Auth()); err != nil {
+		return fmt.Errorf("mtproto login: code: %w", err)
+	}
+	return nil
+}
+
+var errNotRegistered = errors.New("phone is not registered in Telegram, sign up in the official app first")
+
+// promptAuth берет телефон и пароль из конфига, а чего там нет, спрашивает через prompter
+type promptAuth struct {
+	p        prompter
+	phone    string
+	password string
+}
+
+func (a promptAuth) Phone(ctx context.Context) (string, error) {
+	if a.phone != "" {
+		return a.phone, nil
+	}
+	return a.p.ask(ctx, fieldPhone)
+}
+
+func (a promptAuth) Password(ctx context.Context) (string, error) {
+	if a.password != "" {
+		return a.password, nil
+	}
+	return a.p.ask(ctx, fieldPassword)
+}
+
+func (a promptAuth) Code(ctx context.Context, _ *tg.AuthSentCode) (string, error) {
+	return a.p.ask(ctx, fieldCode)
+}
+
+func (a promptAuth) AcceptTermsOfService(context.Context, tg.HelpTermsOfService) error {
+	return errNotRegistered
+}
+
+func (a promptAuth) SignUp(context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{}, errNotRegistered
+}
+
+// printQR рисует QR полублоками: светлые модули закрашены, так что код читается
+// на темном фоне терминала; вокруг рамка тишины в 2 модуля, меньше сканеры не любят
+func printQR(out io.Writer, url string) error {
+	code, err := qr.Encode(url, qr.L)
+	if err != nil {
+		return fmt.Errorf("encode qr: %w", err)
+	}
+
+	const quiet = 2
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return true
+		}
+		return !code.Black(x, y)
+	}
+
+	var b strings.Builder
+	b.WriteString("\n")
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(url)
+	b.WriteString("\n\n")
+
+	_, err = io.WriteString(out, b.String())
+	return err
+}
@@ -0,0 +1,290 @@
+package mtproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	cfg "github.com/faringet/telegram-bot-scraper/pkg/config"
+)
+
+// ErrNoAccounts: в пуле не осталось аккаунтов, которые сейчас могут работать
+var ErrNoAccounts = errors.New("mtproto: no available accounts")
+
+// Account это один аккаунт пула
+type Account struct {
+	Name string
+
+	client *Client
+
+	// td != nil, пока клиент аккаунта запущен и авторизован
+	// limitedUntil: после долгого FLOOD_WAIT аккаунт отдыхает,
+	// dead: сессию разлогинили или аккаунт забанен, до рестарта не используем
+	mu           sync.RWMutex
+	td           *telegram.Client
+	limitedUntil time.Time
+	dead         error
+}
+
+// API это клиент Telegram API аккаунта, nil если аккаунт не запущен
+func (a *Account) API() *tg.Client {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.td == nil {
+		return nil
+	}
+	return a.td.API()
+}
+
+// TD это сам клиент аккаунта, нужен для потока обновлений
+func (a *Account) TD() *telegram.Client {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.td
+}
+
+func (a *Account) available(now time.Time) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.td != nil && a.dead == nil && !now.Before(a.limitedUntil)
+}
+
+// Pool это несколько аккаунтов, между которыми раскладываются каналы
+//
+// канал закрепляется за аккаунтом через rendezvous hashing: пока аккаунт жив,
+// канал всегда идет через него, а если аккаунт выпал, на другие аккаунты
+// переезжают только его каналы. Лимиты запросов у каждого аккаунта свои
+type Pool struct {
+	log      *slog.Logger
+	accounts []*Account
+}
+
+// NewPool создает клиентов для всех аккаунтов из mtproto.accounts
+// updates слушает только первый аккаунт, nil выключает обновления
+// sessions нужен только при mtproto.session_store.driver = postgres
+func NewPool(c cfg.MTProto, sessions SessionStore, logg *slog.Logger, updates telegram.UpdateHandler) (*Pool, error) {
+	if logg == nil {
+		logg = slog.Default()
+	}
+
+	list := c.AccountList()
+	p := &Pool{
+		log: logg.With(
+			slog.String("layer", "transport"),
+			slog.String("module", "collector.mtproto.pool"),
+		),
+		accounts: make([]*Account, 0, len(list)),
+	}
+
+	for i, a := range list {
+		var h telegram.UpdateHandler
+		if i == 0 {
+			h = updates
+		}
+
+		ac := c.ForAccount(a)
+		alog := logg.With(slog.String("account", a.Name))
+
+		sess, err := openSession(a.Name, ac, sessions, alog)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", a.Name, err)
+		}
+		client, err := New(ac, sess, alog, h)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", a.Name, err)
+		}
+		p.accounts = append(p.accounts, &Account{Name: a.Name, client: client})
+	}
+
+	return p, nil
+}
+
+// Len это сколько аккаунтов в пуле, включая выпавшие
+func (p *Pool) Len() int {
+	return len(p.accounts)
+}
+
+// Primary это первый аккаунт, через него идет поток обновлений
+// nil, если он не запустился
+func (p *Pool) Primary() *Account {
+	if len(p.accounts) == 0 || p.accounts[0].TD() == nil {
+		return nil
+	}
+	return p.accounts[0]
+}
+
+// Run запускает все аккаунты и вызывает fn, когда запустился хотя бы один
+//
+// аккаунты стартуют по очереди, чтобы интерактивный вход не спрашивал коды
+// для нескольких номеров одновременно. Аккаунт, который не смог войти или
+// отвалился по ходу работы, помечается выпавшим, остальные продолжают
+func (p *Pool) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	started := 0
+	var startErrs []error
+
+	for _, a := range p.accounts {
+		ready := make(chan error, 1)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var once sync.Once
+			report := func(err error) { once.Do(func() { ready <- err }) }
+
+			err := a.client.WithClient(ctx, func(ctx context.Context, td *telegram.Client) error {
+				a.mu.Lock()
+				a.td = td
+				a.mu.Unlock()
+				report(nil)
+
+				<-ctx.Done()
+				return ctx.Err()
+			})
+
+			a.mu.Lock()
+			a.td = nil
+			a.mu.Unlock()
+
+			if err != nil && ctx.Err() == nil {
+				p.markDead(a, err)
+			}
+			report(err)
+		}()
+
+		select {
+		case err := <-ready:
+			if err != nil {
+				startErrs = append(startErrs, fmt.Errorf("account %s: %w", a.Name, err))
+				p.log.Error("account start failed", slog.String("account", a.Name), slog.Any("err", err))
+				continue
+			}
+			started++
+			p.log.Info("account started", slog.String("account", a.Name))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if started == 0 {
+		return errors.Join(append([]error{ErrNoAccounts}, startErrs...)...)
+	}
+
+	p.log.Info("account pool started",
+		slog.Int("started", started),
+		slog.Int("accounts", len(p.accounts)),
+	)
+	return fn(ctx)
+}
+
+// Pick отдает аккаунт, закрепленный за ключом канала, среди тех, что сейчас могут работать
+func (p *Pool) Pick(key string) (*Account, error) {
+	now := time.Now()
+
+	var (
+		best      *Account
+		bestScore uint64
+	)
+	for _, a := range p.accounts {
+		if !a.available(now) {
+			continue
+		}
+		if score := rendezvousScore(a.Name, key); best == nil || score > bestScore {
+			best, bestScore = a, score
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoAccounts
+	}
+	return best, nil
+}
+
+func rendezvousScore(account, key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(account))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Failover разбирает ошибку запроса через аккаунт: если виноват сам аккаунт
+// (долгий FLOOD_WAIT, который rate limiter не стал ждать, или потерянная авторизация),
+// он выводится из работы и возвращается true, а запрос стоит повторить на другом аккаунте
+func (p *Pool) Failover(a *Account, err error) bool {
+	if err == nil || a == nil {
+		return false
+	}
+
+	if d, ok := tgerr.AsFloodWait(err); ok {
+		until := time.Now().Add(d)
+
+		a.mu.Lock()
+		if until.After(a.limitedUntil) {
+			a.limitedUntil = until
+		}
+		a.mu.Unlock()
+
+		p.log.Warn("account rate limited, moving its channels to other accounts",
+			slog.String("account", a.Name),
+			slog.Time("until", until),
+		)
+		return true
+	}
+
+	if isDeauthorized(err) {
+		p.markDead(a, err)
+		return true
+	}
+	return false
+}
+
+func (p *Pool) markDead(a *Account, err error) {
+	a.mu.Lock()
+	first := a.dead == nil
+	if first {
+		a.dead = err
+	}
+	a.mu.Unlock()
+
+	if first {
+		p.log.Error("account is out of the pool until restart",
+			slog.String("account", a.Name),
+			slog.Any("err", err),
+		)
+	}
+}
+
+// isDeauthorized: сессию отозвали, аккаунт удален или забанен
+func isDeauthorized(err error) bool {
+	return auth.IsUnauthorized(err) ||
+		tgerr.Is(err, "USER_DEACTIVATED_BAN", "PHONE_NUMBER_BANNED", "AUTH_KEY_DUPLICATED")
+}
+
+// TakeRateStats складывает статистику FLOOD_WAIT всех аккаунтов
+// CurrentDelay берется максимальный
+func (p *Pool) TakeRateStats() RateStats {
+	var out RateStats
+	for _, a := range p.accounts {
+		st := a.client.TakeRateStats()
+		out.FloodWaits += st.FloodWaits
+		out.Waited += st.Waited
+		out.CurrentDelay = max(out.CurrentDelay, st.CurrentDelay)
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+package mtproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/faringet/telegram-bot-scraper/pkg/config"
+)
+
+// что может спросить вход: телефон, код из Telegram / SMS и пароль 2FA
+const (
+	fieldPhone    = "phone"
+	fieldCode     = "code"
+	fieldPassword = "password"
+)
+
+// prompter спрашивает у человека то, чего нет в конфиге
+type prompter interface {
+	ask(ctx context.Context, field string) (string, error)
+	close()
+}
+
+// newPrompter выбирает, откуда брать ввод: форма на login.http_addr, файл login.code_file
+// или stdin, если allow_interactive_auth. Без всего этого вход по QR все равно работает,
+// пока не понадобится пароль 2FA
+func newPrompter(account string, c cfg.MTProto, log *slog.Logger) (prompter, error) {
+	switch {
+	case strings.TrimSpace(c.Login.HTTPAddr) != "":
+		return newHTTPPrompter(account, c.Login.HTTPAddr, log)
+	case strings.TrimSpace(c.Login.CodeFile) != "":
+		return &filePrompter{base: c.Login.CodeFile, log: log}, nil
+	case c.AllowInteractiveAuth:
+		return stdinPrompter{}, nil
+	}
+	return noPrompter{}, nil
+}
+
+type noPrompter struct{}
+
+func (noPrompter) ask(_ context.Context, field string) (string, error) {
+	return "", fmt.Errorf("mtproto login: %s is required, set mtproto.login.http_addr or mtproto.login.code_file to enter it", field)
+}
+
+func (noPrompter) close() {}
+
+type stdinPrompter struct{}
+
+func (stdinPrompter) ask(_ context.Context, field string) (string, error) {
+	v := readLine("Enter " + field + ": ")
+	if v == "" {
+		return "", fmt.Errorf("mtproto login: empty %s", field)
+	}
+	return v, nil
+}
+
+func (stdinPrompter) close() {}
+
+// filePrompter ждет, пока значение положат в файл: код в base, остальное в base.<field>
+// прочитанный файл удаляется, чтобы код не лежал на диске
+type filePrompter struct {
+	base string
+	log  *slog.Logger
+}
+
+func (p *filePrompter) path(field string) string {
+	if field == fieldCode {
+		return p.base
+	}
+	return p.base + "." + field
+}
+
+func (p *filePrompter) ask(ctx context.Context, field string) (string, error) {
+	path := p.path(field)
+
+	// код от прошлой попытки уже не подойдет, телефон и пароль можно положить заранее
+	if field == fieldCode {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("mtproto login: remove stale %s: %w", path, err)
+		}
+	}
+
+	p.log.Info("waiting for login input", slog.String("field", field), slog.String("file", path))
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		b, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if v := strings.TrimSpace(string(b)); v != "" {
+				_ = os.Remove(path)
+				return v, nil
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return "", fmt.Errorf("mtproto login: read %s: %w", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (p *filePrompter) close() {}
+
+// httpPrompter это маленькая форма на локальном адресе
+// форма показывает только то, что спрашивается прямо сейчас, иначе просит подождать
+type httpPrompter struct {
+	account string
+	addr    string
+	log     *slog.Logger
+	srv     *http.Server
+
+	mu      sync.Mutex
+	field   string
+	answers chan string
+}
+
+var promptPage = template.Must(template.New("login").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>tgcollector login: {{.Account}}</title>
+{{if not .Field}}<meta http-equiv="refresh" content="2">{{end}}</head>
+<body style="font-family: sans-serif; max-width: 28em; margin: 3em auto">
+<h3>tgcollector login: {{.Account}}</h3>
+{{if .Field}}<form method="post">
+<input type="hidden" name="field" value="{{.Field}}">
+<label>{{.Field}}<br><input name="value" {{if eq .Field "password"}}type="password"{{end}} autofocus autocomplete="off"></label>
+<button type="submit">OK</button>
+</form>{{else}}<p>Nothing to enter right now, the page will refresh.</p>{{end}}
+</body></html>`))
+
+func newHTTPPrompter(account, addr string, log *slog.Logger) (*httpPrompter, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("mtproto login: listen %s: %w", addr, err)
+	}
+
+	p := &httpPrompter{
+		account: account,
+		addr:    ln.Addr().String(),
+		log:     log,
+		answers: make(chan string, 1),
+	}
+	p.srv = &http.Server{
+		Handler:           http.HandlerFunc(p.serveHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := p.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("login form stopped", slog.Any("err", err))
+		}
+	}()
+
+	log.Info("login form started", slog.String("addr", p.addr))
+	return p, nil
+}
+
+func (p *httpPrompter) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p.mu.Lock()
+		field := p.field
+		p.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = promptPage.Execute(w, struct{ Account, Field string }{p.account, field})
+
+	case http.MethodPost:
+		field := r.FormValue("field")
+		value := strings.TrimSpace(r.FormValue("value"))
+
+		p.mu.Lock()
+		ok := field != "" && field == p.field && value != ""
+		if ok {
+			// поле снимаем сразу, чтобы повторная отправка формы не ушла вторым ответом
+			p.field = ""
+			p.answers <- value
+		}
+		p.mu.Unlock()
+
+		if !ok {
+			http.Error(w, "nothing is asked for "+field, http.StatusConflict)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *httpPrompter) ask(ctx context.Context, field string) (string, error) {
+	p.mu.Lock()
+	p.field = field
+	// ответ, до которого прошлый ask не дождался, к этому вопросу не относится
+	select {
+	case <-p.answers:
+	default:
+	}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.field = ""
+		p.mu.Unlock()
+	}()
+
+	p.log.Info("waiting for login input", slog.String("field", field), slog.String("addr", p.addr))
+
+	select {
+	case v := <-p.answers:
+		return v, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (p *httpPrompter) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = p.srv.Shutdown(ctx)
+}
@@ -0,0 +1,186 @@
+package mtproto
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	cfg "github.com/faringet/telegram-bot-scraper/pkg/config"
+)
+
+// relaxAfter: столько успешных запросов подряд, и пауза между запросами
+// снова уменьшается вдвое (но не ниже min_delay)
+const relaxAfter = 20
+
+// RateStats это статистика FLOOD_WAIT с последнего TakeStats
+type RateStats struct {
+	FloodWaits   int
+	Waited       time.Duration
+	CurrentDelay time.Duration
+}
+
+// rateLimiter это middleware для всех MTProto запросов клиента
+//
+// держит не больше concurrency запросов одновременно и паузу min_delay между ними.
+// На FLOOD_WAIT_X спит X и повторяет запрос, а заодно удваивает паузу для всех
+// следующих запросов (до max_delay). После relaxAfter успехов подряд пауза снова
+// уменьшается
+type rateLimiter struct {
+	log *slog.Logger
+
+	minDelay     time.Duration
+	maxDelay     time.Duration
+	maxFloodWait time.Duration
+	maxRetries   int
+
+	sem chan struct{}
+
+	mu        sync.Mutex
+	delay     time.Duration
+	next      time.Time
+	successes int
+	stats     RateStats
+}
+
+func newRateLimiter(r cfg.Rate, log *slog.Logger) *rateLimiter {
+	maxDelay := r.MaxDelay
+	if maxDelay < r.MinDelay {
+		maxDelay = r.MinDelay
+	}
+
+	return &rateLimiter{
+		log:          log,
+		minDelay:     r.MinDelay,
+		maxDelay:     maxDelay,
+		maxFloodWait: r.FloodWaitLimit(),
+		maxRetries:   r.Retries(),
+		sem:          make(chan struct{}, r.Concurrency),
+		delay:        r.MinDelay,
+	}
+}
+
+func (l *rateLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		for attempt := 0; ; attempt++ {
+			err := l.invoke(ctx, next, input, output)
+
+			d, ok := tgerr.AsFloodWait(err)
+			if !ok {
+				if err == nil {
+					l.onSuccess()
+				}
+				return err
+			}
+
+			l.onFloodWait(d)
+			if attempt >= l.maxRetries || (l.maxFloodWait > 0 && d > l.maxFloodWait) {
+				l.log.Warn("flood wait: giving up",
+					slog.Duration("wait", d),
+					slog.Int("attempt", attempt+1),
+				)
+				return err
+			}
+
+			l.log.Warn("flood wait: sleeping",
+				slog.Duration("wait", d),
+				slog.Int("attempt", attempt+1),
+				slog.Duration("delay", l.currentDelay()),
+			)
+			if err := sleepCtx(ctx, d); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (l *rateLimiter) invoke(ctx context.Context, next tg.Invoker, input bin.Encoder, output bin.Decoder) error {
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.sem }()
+
+	if err := sleepCtx(ctx, l.reserveSlot()); err != nil {
+		return err
+	}
+	return next.Invoke(ctx, input, output)
+}
+
+// reserveSlot занимает ближайшее свободное время для запроса и возвращает, сколько до него ждать
+func (l *rateLimiter) reserveSlot() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.delay)
+	return at.Sub(now)
+}
+
+func (l *rateLimiter) onSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.successes++
+	if l.successes >= relaxAfter && l.delay > l.minDelay {
+		l.delay = max(l.delay/2, l.minDelay)
+		l.successes = 0
+	}
+}
+
+func (l *rateLimiter) onFloodWait(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.successes = 0
+	l.delay = min(l.delay*2, l.maxDelay)
+	l.stats.FloodWaits++
+	l.stats.Waited += d
+
+	// пока ждем, другие запросы тоже не пускаем
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
+
+func (l *rateLimiter) currentDelay() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.delay
+}
+
+// takeStats отдает статистику и обнуляет счетчики
+func (l *rateLimiter) takeStats() RateStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st := l.stats
+	st.CurrentDelay = l.delay
+	l.stats = RateStats{}
+	return st
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
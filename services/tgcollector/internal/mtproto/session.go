@@ -0,0 +1,165 @@
+package mtproto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gotd/td/session"
+
+	cfg "github.com/faringet/telegram-bot-scraper/pkg/config"
+)
+
+// SessionStore это таблица сессий, в collector это storage.Postgres
+// данные туда приходят уже зашифрованными
+type SessionStore interface {
+	LoadMTProtoSession(ctx context.Context, account string) ([]byte, bool, error)
+	StoreMTProtoSession(ctx context.Context, account string, data []byte) error
+}
+
+// sessionVersion это первый байт зашифрованной сессии, чтобы потом можно было сменить формат
+const sessionVersion = 1
+
+// openSession отдает хранилище сессии аккаунта по mtproto.session_store
+func openSession(account string, c cfg.MTProto, store SessionStore, log *slog.Logger) (session.Storage, error) {
+	if c.SessionStore.Driver != cfg.SessionStorePostgres {
+		return &session.FileStorage{Path: c.Session}, nil
+	}
+	if store == nil {
+		return nil, errors.New("mtproto: postgres session store is not available")
+	}
+
+	key, err := sessionKey(c.SessionStore)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("mtproto: session key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("mtproto: session key: %w", err)
+	}
+
+	return &dbSession{
+		account:  account,
+		filePath: c.Session,
+		store:    store,
+		aead:     aead,
+		log:      log,
+	}, nil
+}
+
+func sessionKey(c cfg.MTProtoSessionStore) ([]byte, error) {
+	raw := strings.TrimSpace(c.Key)
+	if raw == "" && c.KeyFile != "" {
+		b, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("mtproto: read session key file: %w", err)
+		}
+		raw = strings.TrimSpace(string(b))
+	}
+	if raw == "" {
+		return nil, errors.New("mtproto: session key is empty")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("mtproto: session key must be base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("mtproto: session key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// dbSession хранит сессию в Postgres, зашифрованной AES-GCM
+//
+// имя аккаунта идет в additional data, так что строку одного аккаунта
+// нельзя подложить другому. Если в базе сессии еще нет, а файл по mtproto.session есть,
+// он один раз переносится в базу: так переезжают с file без повторного входа
+type dbSession struct {
+	account  string
+	filePath string
+	store    SessionStore
+	aead     cipher.AEAD
+	log      *slog.Logger
+}
+
+func (s *dbSession) LoadSession(ctx context.Context) ([]byte, error) {
+	data, ok, err := s.store.LoadMTProtoSession(ctx, s.account)
+	if err != nil {
+		return nil, fmt.Errorf("load session: %w", err)
+	}
+	if ok {
+		return s.open(data)
+	}
+
+	return s.importFile(ctx)
+}
+
+func (s *dbSession) StoreSession(ctx context.Context, data []byte) error {
+	if err := s.store.StoreMTProtoSession(ctx, s.account, s.seal(data)); err != nil {
+		return fmt.Errorf("store session: %w", err)
+	}
+	return nil
+}
+
+func (s *dbSession) importFile(ctx context.Context) ([]byte, error) {
+	if s.filePath == "" {
+		return nil, session.ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.filePath)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return nil, session.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session file: %w", err)
+	}
+
+	if err := s.StoreSession(ctx, data); err != nil {
+		return nil, err
+	}
+	s.log.Info("session imported from file into postgres, the file can be removed",
+		slog.String("account", s.account),
+		slog.String("file", s.filePath),
+	)
+	return data, nil
+}
+
+func (s *dbSession) seal(data []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	// crypto/rand.Read не возвращает ошибку с Go 1.24
+	_, _ = rand.Read(nonce)
+
+	out := make([]byte, 0, 1+len(nonce)+len(data)+s.aead.Overhead())
+	out = append(out, sessionVersion)
+	out = append(out, nonce...)
+	return s.aead.Seal(out, nonce, data, s.additionalData())
+}
+
+func (s *dbSession) open(data []byte) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(data) < 1+n || data[0] != sessionVersion {
+		return nil, errors.New("decrypt session: unknown format")
+	}
+
+	plain, err := s.aead.Open(nil, data[1:1+n], data[1+n:], s.additionalData())
+	if err != nil {
+		return nil, errors.New("decrypt session: wrong mtproto.session_store key or damaged data")
+	}
+	return plain, nil
+}
+
+func (s *dbSession) additionalData() []byte {
+	return []byte("tgcollector session " + s.account)
+}
@@ -0,0 +1,222 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// Config это чистка hits старше Window с выгрузкой в Dir
+type Config struct {
+	Window    time.Duration
+	Dir       string
+	BatchSize int
+}
+
+// Result это итог одного прогона
+type Result struct {
+	Archived int
+	Pruned   int
+	// MediaRemoved это сколько файлов hit_media удалено с диска вместе с hits
+	MediaRemoved int
+	// File пустой, если удалять было нечего
+	File string
+}
+
+type Retention struct {
+	cfg   Config
+	log   *slog.Logger
+	store storage.Store
+}
+
+func New(cfg Config, log *slog.Logger, store storage.Store) (*Retention, error) {
+	if store == nil {
+		return nil, errors.New("retention: store is nil")
+	}
+	if cfg.Window <= 0 {
+		return nil, errors.New("retention: window must be > 0")
+	}
+	if cfg.Dir == "" {
+		return nil, errors.New("retention: dir is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &Retention{
+		cfg: cfg,
+		log: log.With(
+			slog.String("layer", "worker"),
+			slog.String("module", "collector.retention"),
+		),
+		store: store,
+	}, nil
+}
+
+// Run выгружает и удаляет все hits, созданные раньше now - Window, и пишет итог в retention_runs
+//
+// hits идут пачками по BatchSize: пачка дописывается в файл отдельным gzip member,
+// файл синкается, и только потом пачка удаляется. Так прерванный прогон
+// не теряет строк, а файл остается читаемым (zcat и gzip.Reader склеивают members)
+func (r *Retention) Run(ctx context.Context) (Result, error) {
+	started := time.Now().UTC()
+	cutoff := started.Add(-r.cfg.Window)
+
+	res, err := r.run(ctx, started, cutoff)
+
+	run := storage.RetentionRun{
+		StartedAt: started,
+		Cutoff:    cutoff,
+		Archived:  res.Archived,
+		Pruned:    res.Pruned,
+		File:      res.File,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	// итог пишем и при отмене ctx, иначе прерванный прогон пропадет из retention_runs
+	recCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if recErr := r.store.RecordRetentionRun(recCtx, run); recErr != nil {
+		r.log.Warn("record retention run failed", slog.Any("err", recErr))
+	}
+
+	r.log.Info("retention done",
+		slog.Time("cutoff", cutoff),
+		slog.Int("archived", res.Archived),
+		slog.Int("pruned", res.Pruned),
+		slog.Int("media_removed", res.MediaRemoved),
+		slog.String("file", res.File),
+		slog.Duration("duration", time.Since(started)),
+	)
+
+	return res, err
+}
+
+func (r *Retention) run(ctx context.Context, started, cutoff time.Time) (Result, error) {
+	var (
+		res Result
+		f   *os.File
+	)
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		hits, err := r.store.ListExpiredHits(ctx, cutoff, r.cfg.BatchSize)
+		if err != nil {
+			return res, err
+		}
+		if len(hits) == 0 {
+			break
+		}
+
+		if f == nil {
+			if f, res.File, err = r.createFile(started); err != nil {
+				return res, err
+			}
+		}
+
+		if err := writeBatch(f, hits); err != nil {
+			return res, fmt.Errorf("retention: write %s: %w", res.File, err)
+		}
+		res.Archived += len(hits)
+
+		ids := make([]int64, 0, len(hits))
+		for _, h := range hits {
+			ids = append(ids, h.ID)
+		}
+		n, media, err := r.store.Prune(ctx, cutoff, ids)
+		if err != nil {
+			return res, err
+		}
+		res.Pruned += n
+		// строки hit_media уже удалены, так что файлы только с диска:
+		// пути и метаданные остались в выгрузке
+		res.MediaRemoved += r.removeMedia(ctx, media)
+
+		// иначе та же пачка придет снова, и цикл не закончится
+		if n == 0 {
+			return res, errors.New("retention: prune removed nothing, stopping")
+		}
+	}
+
+	if f != nil {
+		if err := f.Close(); err != nil {
+			f = nil
+			return res, fmt.Errorf("retention: close %s: %w", res.File, err)
+		}
+		f = nil
+	}
+	return res, nil
+}
+
+// removeMedia удаляет файлы, на которые больше не ссылается ни один hit
+// пока hits удалялись, тот же файл мог понадобиться новому hit, поэтому каждый путь
+// перепроверяет RemoveMediaFile. Ошибка по одному файлу прогон не останавливает:
+// hits уже удалены, а файл в худшем случае останется лежать
+func (r *Retention) removeMedia(ctx context.Context, paths []string) int {
+	removed := 0
+	for _, p := range paths {
+		ok, err := r.store.RemoveMediaFile(ctx, p, func() error {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			r.log.Warn("remove media failed", slog.String("path", p), slog.Any("err", err))
+			continue
+		}
+		if ok {
+			removed++
+		}
+	}
+	return removed
+}
+
+func (r *Retention) createFile(started time.Time) (*os.File, string, error) {
+	if err := os.MkdirAll(r.cfg.Dir, 0o750); err != nil {
+		return nil, "", fmt.Errorf("retention: create dir: %w", err)
+	}
+
+	path := filepath.Join(r.cfg.Dir, "hits-"+started.Format("20060102T150405Z")+".jsonl.gz")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, "", fmt.Errorf("retention: create %s: %w", path, err)
+	}
+	return f, path, nil
+}
+
+func writeBatch(f *os.File, hits []storage.ExpiredHit) error {
+	gz := gzip.NewWriter(f)
+	for _, h := range hits {
+		if _, err := gz.Write(h.JSON); err != nil {
+			return err
+		}
+		if _, err := gz.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
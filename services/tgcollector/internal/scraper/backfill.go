@@ -0,0 +1,197 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// BackfillConfig это догрузка истории каналов назад до Since
+// за один проход по каналу читается не больше ChunkSize сообщений,
+// прогресс хранится в checkpoints.oldest_message_id, так что проход можно прервать в любой момент
+type BackfillConfig struct {
+	Since     time.Time
+	ChunkSize int
+	MinDelay  time.Duration
+
+	// Notify: отдавать найденное в notifier. По умолчанию нет, иначе старые новости
+	// за месяцы разом уйдут в supervisor чат. В поиск они попадают в любом случае
+	Notify bool
+}
+
+// BackfillResult это итог одного прохода: Pending каналов еще не догружены,
+// из них Failed упали с ошибкой или сидят в карантине
+type BackfillResult struct {
+	Pending int
+	Failed  int
+}
+
+func (r BackfillResult) Done() bool { return r.Pending == 0 }
+
+// Backfill делает один проход backfill по всем каналам, по очереди и без параллельности,
+// чтобы не отнимать лимиты у инкрементального обхода
+func (s *Scraper) Backfill(ctx context.Context, pool *mtclient.Pool, c BackfillConfig) (BackfillResult, error) {
+	var res BackfillResult
+	if c.Since.IsZero() {
+		return res, fmt.Errorf("scraper: backfill since is required")
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = 500
+	}
+
+	jobs := s.refreshSources(ctx)
+	quarantined := s.loadQuarantined(ctx)
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		if job.src.key() == "" {
+			continue
+		}
+		if _, ok := quarantined[job.src.name()]; ok {
+			res.Pending++
+			res.Failed++
+			continue
+		}
+
+		var done bool
+		err := s.onAccount(ctx, pool, job.src, func(acc *mtclient.Account) error {
+			var err error
+			done, err = s.backfillChannel(ctx, acc, job.src, job.group, c)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			res.Pending++
+			res.Failed++
+			s.log.Error("backfill channel failed",
+				slog.String("channel", job.src.name()),
+				slog.Any("err", err),
+			)
+			continue
+		}
+		if !done {
+			res.Pending++
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Scraper) backfillChannel(ctx context.Context, acc *mtclient.Account, src source, g *channelGroup, c BackfillConfig) (bool, error) {
+	key := src.key()
+	st, err := s.store.GetBackfillState(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("get backfill state %s: %w", src.name(), err)
+	}
+	if st.Completed {
+		return true, nil
+	}
+	// уже дошли до нужной даты при прошлом, более коротком backfill
+	if !st.OldestMessageDate.IsZero() && st.OldestMessageDate.Before(c.Since) {
+		st.Completed = true
+		return true, s.store.SetBackfillState(ctx, key, st)
+	}
+
+	api, err := accountAPI(acc)
+	if err != nil {
+		return false, err
+	}
+	ch, err := s.resolveSource(ctx, acc, src)
+	if err != nil {
+		return false, err
+	}
+
+	// сообщения моложе lookback группы обычный обход отдал бы в notifier, так что и backfill
+	// их тихими не делает: иначе backfill по новому каналу до первого обхода
+	// пометил бы новости этой недели доставленными, и notifier их бы не отправил
+	recent := time.Now().UTC().Add(-g.lookback)
+
+	const batchLimit = 100
+	scanned := 0
+	hitsNew := 0
+	stopReason := "chunk_done"
+
+	for scanned < c.ChunkSize && !st.Completed {
+		if err := sleepCtx(ctx, c.MinDelay); err != nil {
+			return false, err
+		}
+
+		// offset_id = самое старое уже пройденное сообщение, отдаются только более старые
+		res, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+			Peer:     ch.peer,
+			Limit:    batchLimit,
+			OffsetID: int(st.OldestMessageID),
+		})
+		if err != nil {
+			if isPeerRejected(err) {
+				// следующий проход найдет канал заново
+				s.forgetPeer(ctx, acc, src)
+			}
+			return false, fmt.Errorf("backfill history(%s, offset=%d): %w", src.name(), st.OldestMessageID, err)
+		}
+
+		msgs := extractMessages(res)
+		if len(msgs) == 0 {
+			stopReason = "channel_start"
+			st.Completed = true
+		}
+
+		for _, mc := range msgs {
+			// служебные сообщения тоже сдвигают границу, иначе на странице из одних служебных зациклимся
+			scanned++
+			if id := int64(mc.GetID()); st.OldestMessageID == 0 || id < st.OldestMessageID {
+				st.OldestMessageID = id
+			}
+
+			m, ok := mc.(*tg.Message)
+			if !ok {
+				continue
+			}
+
+			msgTime := time.Unix(int64(m.Date), 0).UTC()
+			if msgTime.Before(c.Since) {
+				stopReason = "reached_since"
+				st.Completed = true
+				break
+			}
+
+			silent := !c.Notify && msgTime.Before(recent)
+			r, err := s.processMessage(ctx, api, ch, g, m, silent)
+			if err != nil {
+				return false, err
+			}
+			if r == storage.SaveInserted {
+				hitsNew++
+			}
+
+			st.OldestMessageDate = msgTime
+		}
+
+		if err := s.store.SetBackfillState(ctx, key, st); err != nil {
+			return false, fmt.Errorf("set backfill state %s: %w", src.name(), err)
+		}
+	}
+
+	s.log.Info("backfill channel chunk done",
+		slog.String("channel", src.name()),
+		slog.String("group", g.name),
+		slog.Int("scanned", scanned),
+		slog.Int("hits_new", hitsNew),
+		slog.Int64("oldest_id", st.OldestMessageID),
+		slog.Time("oldest_date", st.OldestMessageDate),
+		slog.String("stop_reason", stopReason),
+	)
+
+	return st.Completed, nil
+}
@@ -5,51 +5,92 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gotd/td/tg"
 
+	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
 	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
 )
 
-func (s *Scraper) scanChannel(ctx context.Context, api *tg.Client, username string, keywords []string) error {
-	peer, linkBase, err := ResolvePublicChannel(ctx, api, username)
+// scanChannel обходит историю одного канала и возвращает причину остановки
+//
+// канал берется из сохраненных, и только если Telegram его не принял,
+// ищется заново, после чего обход повторяется один раз
+func (s *Scraper) scanChannel(ctx context.Context, acc *mtclient.Account, src source, g *channelGroup) (string, error) {
+	api, err := accountAPI(acc)
 	if err != nil {
-		return err
+		return "", err
 	}
+	ch, err := s.resolveSource(ctx, acc, src)
+	if err != nil {
+		return "", err
+	}
+
+	stopReason, err := s.scanPeer(ctx, api, src, ch, g)
+	if err == nil || !isPeerRejected(err) {
+		return stopReason, err
+	}
+
+	s.log.Warn("cached peer rejected, resolving again",
+		slog.String("channel", src.name()),
+		slog.Any("err", err),
+	)
+	s.forgetPeer(ctx, acc, src)
+
+	if ch, err = s.resolveSource(ctx, acc, src); err != nil {
+		return "", err
+	}
+	return s.scanPeer(ctx, api, src, ch, g)
+}
+
+func (s *Scraper) scanPeer(ctx context.Context, api *tg.Client, src source, ch *channelPeer, g *channelGroup) (string, error) {
+	s.rememberChannel(ch.peer.ChannelID, src, ch)
+
+	key := src.key()
 
 	var cutoff time.Time
-	if s.cfg.Lookback > 0 {
-		cutoff = time.Now().Add(-s.cfg.Lookback)
+	if g.lookback > 0 {
+		cutoff = time.Now().Add(-g.lookback)
+	}
+
+	// за чекпоинт заходим только в пределах editWindow: ради правок и свежих счетчиков
+	var editCutoff time.Time
+	if s.cfg.EditWindow > 0 {
+		editCutoff = time.Now().Add(-s.cfg.EditWindow)
 	}
 
-	lastID, err := s.store.GetCheckpoint(ctx, username)
+	lastID, err := s.store.GetCheckpoint(ctx, key)
 	if err != nil {
-		return fmt.Errorf("get checkpoint @%s: %w", username, err)
+		return "", fmt.Errorf("get checkpoint %s: %w", src.name(), err)
 	}
 
 	const batchLimit = 100
 	scanned := 0
 	hitsNew := 0
+	hitsEdited := 0
 
 	offsetID := 0
 	addOffset := 0
 	maxSeen := lastID
+	// lowestSeen нужен, чтобы понять, дошли ли мы до lastID или между ними осталась дыра
+	var lowestSeen int64
 
 	stopReason := "max_scan"
 
-	for scanned < s.cfg.PerChannelMaxScan {
-		if err := sleepCtx(ctx, s.cfg.MinDelay); err != nil {
-			return err
+	for scanned < g.perChannelMaxScan {
+		if err := sleepCtx(ctx, g.minDelay); err != nil {
+			return "", err
 		}
 
 		res, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-			Peer:      peer,
+			Peer:      ch.peer,
 			Limit:     batchLimit,
 			OffsetID:  offsetID,
 			AddOffset: addOffset,
 		})
 		if err != nil {
-			return fmt.Errorf("history(@%s, offset=%d): %w", username, offsetID, err)
+			return "", fmt.Errorf("history(%s, offset=%d): %w", src.name(), offsetID, err)
 		}
 
 		msgs := extractMessages(res)
@@ -75,41 +116,35 @@ func (s *Scraper) scanChannel(ctx context.Context, api *tg.Client, username stri
 			if msgID > maxSeen {
 				maxSeen = msgID
 			}
+			if lowestSeen == 0 || msgID < lowestSeen {
+				lowestSeen = msgID
+			}
+
+			msgTime := time.Unix(int64(m.Date), 0)
 
 			if lastID > 0 && msgID <= lastID {
-				stopReason = "reached_last_id"
-				scanned = s.cfg.PerChannelMaxScan
-				break
+				if editCutoff.IsZero() || msgTime.Before(editCutoff) {
+					stopReason = "reached_last_id"
+					scanned = g.perChannelMaxScan
+					break
+				}
 			}
 
-			msgTime := time.Unix(int64(m.Date), 0)
 			if !cutoff.IsZero() && msgTime.Before(cutoff) {
 				stopReason = "reached_cutoff"
-				scanned = s.cfg.PerChannelMaxScan
+				scanned = g.perChannelMaxScan
 				break
 			}
 
-			text := m.Message
-			kw, ok := containsAnyKeyword(text, keywords)
-			if !ok {
-				continue
-			}
-
-			h := storage.Hit{
-				Channel:     "@" + username,
-				MessageID:   msgID,
-				MessageDate: msgTime.UTC(),
-				Text:        text,
-				Link:        fmt.Sprintf("%s/%d", linkBase, m.ID),
-				Keyword:     kw,
-			}
-
-			inserted, err := s.store.SaveHit(ctx, h)
+			res, err := s.processMessage(ctx, api, ch, g, m, false)
 			if err != nil {
-				return fmt.Errorf("save hit: %w", err)
+				return "", err
 			}
-			if inserted {
+			switch res {
+			case storage.SaveInserted:
 				hitsNew++
+			case storage.SaveUpdated:
+				hitsEdited++
 			}
 		}
 
@@ -126,19 +161,162 @@ func (s *Scraper) scanChannel(ctx context.Context, api *tg.Client, username stri
 		addOffset = -1
 	}
 
+	gaps, err := s.fillGaps(ctx, api, key, ch, g, cutoff)
+	if err != nil {
+		return "", err
+	}
+	hitsNew += gaps.hitsNew
+
+	// уперлись в лимит, не дойдя до чекпоинта: запоминаем пропущенный диапазон,
+	// его дочитает fillGaps на следующих проходах, а чекпоинт можно двигать
+	if stopReason == "max_scan" && lastID > 0 && lowestSeen > lastID+1 {
+		if err := s.store.AddScanGap(ctx, key, lastID+1, lowestSeen-1); err != nil {
+			return "", fmt.Errorf("add scan gap %s: %w", src.name(), err)
+		}
+		gaps.left++
+	}
+
 	if maxSeen > lastID {
-		if err := s.store.SetCheckpoint(ctx, username, maxSeen); err != nil {
-			return fmt.Errorf("set checkpoint @%s: %w", username, err)
+		if err := s.store.SetCheckpoint(ctx, key, maxSeen); err != nil {
+			return "", fmt.Errorf("set checkpoint %s: %w", src.name(), err)
 		}
 	}
 
+	if err := s.verifyDeleted(ctx, api, ch, g); err != nil {
+		// проверка удалений вторична, из-за нее обход канала не валим
+		s.log.Warn("deleted check failed",
+			slog.String("channel", src.name()),
+			slog.Any("err", err),
+		)
+	}
+
 	s.log.Info("scan channel done",
-		slog.String("channel", "@"+username),
+		slog.String("channel", src.name()),
+		slog.String("group", g.name),
 		slog.Int("scanned", scanned),
 		slog.Int("hits_new", hitsNew),
+		slog.Int("hits_edited", hitsEdited),
 		slog.Int64("new_last_id", maxSeen),
+		slog.Int("gap_scanned", gaps.scanned),
+		slog.Int("gaps", gaps.left),
 		slog.String("stop_reason", stopReason),
 	)
 
-	return nil
+	return stopReason, nil
+}
+
+// processMessage прогоняет одно сообщение через выражения группы и сохраняет hit
+// общая часть для обхода истории и для потока обновлений.
+// Отредактированное сообщение, которое раньше не подходило, а теперь подходит,
+// сохранится как новый hit
+//
+// silent сохраняет hit сразу доставленным, чтобы notifier его не слал (для backfill)
+func (s *Scraper) processMessage(ctx context.Context, api *tg.Client, ch *channelPeer, g *channelGroup, m *tg.Message, silent bool) (storage.SaveResult, error) {
+	meta, stats := messageMeta(m)
+
+	msg := storage.Message{
+		Channel:     ch.name,
+		ChannelID:   ch.peer.ChannelID,
+		MessageID:   int64(m.ID),
+		MessageDate: time.Unix(int64(m.Date), 0).UTC(),
+		Text:        m.Message,
+		Link:        ch.link(m.ID),
+		Group:       g.name,
+		Entities:    messageEntities(m),
+		Meta:        meta,
+		Stats:       stats,
+	}
+	if m.EditDate > 0 {
+		msg.EditDate = time.Unix(int64(m.EditDate), 0).UTC()
+	}
+
+	if s.cfg.Archive {
+		// архив нужен только для rematch, из-за него сообщение не теряем
+		if err := s.store.ArchiveMessage(ctx, msg); err != nil {
+			s.log.Warn("archive message failed",
+				slog.String("channel", msg.Channel),
+				slog.Int64("message_id", msg.MessageID),
+				slog.Any("err", err),
+			)
+		}
+	}
+
+	h, ok := matchMessage(g, msg)
+	if !ok {
+		// правка, после которой сообщение перестало подходить, сейчас не отслеживается,
+		// в hits остается последняя подходившая версия
+		return storage.SaveSkipped, nil
+	}
+	h.Silent = silent
+
+	res, err := s.store.SaveHit(ctx, h)
+	if err != nil {
+		return storage.SaveSkipped, fmt.Errorf("save hit: %w", err)
+	}
+
+	if res == storage.SaveInserted {
+		s.saveMedia(ctx, api, h, m)
+	}
+	return res, nil
+}
+
+// matchMessage собирает hit, если сообщение подходит под выражения группы
+//
+// ищем по тексту вместе с текстовыми метаданными (имя файла, превью ссылки, опрос),
+// позиции совпадений сохраняем только те, что попали в сам текст
+func matchMessage(g *channelGroup, msg storage.Message) (storage.Hit, bool) {
+	text := msg.Text
+	matchText := text
+	if extra := metaText(msg.Meta); extra != "" {
+		if text == "" {
+			// медиа без подписи: сохраняем как текст hit сами метаданные
+			text = extra
+			matchText = extra
+		} else {
+			matchText = text + "\n\n" + extra
+		}
+	}
+
+	matches := g.matcher.MatchAll(matchText)
+	if len(matches) == 0 {
+		return storage.Hit{}, false
+	}
+
+	return storage.Hit{
+		Channel:     msg.Channel,
+		ChannelID:   msg.ChannelID,
+		MessageID:   msg.MessageID,
+		MessageDate: msg.MessageDate,
+		EditDate:    msg.EditDate,
+		Text:        text,
+		TextHTML:    entitiesHTML(text, msg.Entities),
+		Link:        msg.Link,
+		Keyword:     matches[0].Keyword,
+		Group:       g.name,
+		Keywords:    clipHitKeywords(toHitKeywords(matches), utf8.RuneCountInString(text)),
+		Entities:    msg.Entities,
+		Meta:        msg.Meta,
+		Stats:       msg.Stats,
+	}, true
+}
+
+// saveMedia качает медиа нового hit, если это включено
+// ошибки только логируем: hit уже сохранен, без файла он тоже полезен
+func (s *Scraper) saveMedia(ctx context.Context, api *tg.Client, h storage.Hit, m *tg.Message) {
+	if s.media == nil || api == nil {
+		return
+	}
+
+	media, err := s.media.fetch(ctx, api, m)
+	if err == nil && media != nil {
+		err = s.store.SaveHitMedia(ctx, h.Channel, h.MessageID, media.media, media.place)
+		media.discard()
+	}
+	if err != nil {
+		s.log.Warn("media download failed",
+			slog.String("channel", h.Channel),
+			slog.Int64("message_id", h.MessageID),
+			slog.Any("err", err),
+		)
+	}
 }
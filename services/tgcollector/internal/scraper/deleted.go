@@ -0,0 +1,88 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// verifyDeleted перепроверяет свежие hits канала через channels.getMessages
+// и помечает deleted_at те, которые Telegram вернул как MessageEmpty.
+// Для одного канала проверка делается не чаще DeletedCheckInterval
+func (s *Scraper) verifyDeleted(ctx context.Context, api *tg.Client, ch *channelPeer, g *channelGroup) error {
+	if s.cfg.DeletedCheckWindow <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	channel := ch.name
+	if !s.dueDeletedCheck(channel, now) {
+		return nil
+	}
+	ids, err := s.store.ListAliveMessageIDs(ctx, channel, now.Add(-s.cfg.DeletedCheckWindow))
+	if err != nil {
+		return fmt.Errorf("list hits %s: %w", channel, err)
+	}
+
+	const batchLimit = 100
+	input := &tg.InputChannel{ChannelID: ch.peer.ChannelID, AccessHash: ch.peer.AccessHash}
+	deleted := make([]int64, 0)
+
+	for start := 0; start < len(ids); start += batchLimit {
+		end := min(start+batchLimit, len(ids))
+
+		req := make([]tg.InputMessageClass, 0, end-start)
+		for _, id := range ids[start:end] {
+			req = append(req, &tg.InputMessageID{ID: int(id)})
+		}
+
+		if err := sleepCtx(ctx, g.minDelay); err != nil {
+			return err
+		}
+
+		res, err := api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: input,
+			ID:      req,
+		})
+		if err != nil {
+			return fmt.Errorf("get messages %s: %w", channel, err)
+		}
+
+		for _, mc := range extractMessages(res) {
+			if m, ok := mc.(*tg.MessageEmpty); ok {
+				deleted = append(deleted, int64(m.ID))
+			}
+		}
+	}
+
+	marked, err := s.store.MarkDeleted(ctx, channel, deleted)
+	if err != nil {
+		return fmt.Errorf("mark deleted %s: %w", channel, err)
+	}
+
+	s.markDeletedChecked(channel, now)
+
+	s.log.Info("deleted check done",
+		slog.String("channel", channel),
+		slog.Int("checked", len(ids)),
+		slog.Int("deleted", marked),
+	)
+	return nil
+}
+
+func (s *Scraper) dueDeletedCheck(channel string, now time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last, ok := s.deletedCheckedAt[channel]
+	return !ok || now.Sub(last) >= s.cfg.DeletedCheckInterval
+}
+
+func (s *Scraper) markDeletedChecked(channel string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletedCheckedAt[channel] = now
+}
@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// messageEntities переводит разметку сообщения в HitEntity
+//
+// Telegram считает offset/length в UTF-16, а позиции у нас везде в рунах,
+// так что пересчитываем. Разметку, вылезающую за текст, отбрасываем
+func messageEntities(m *tg.Message) []storage.HitEntity {
+	if len(m.Entities) == 0 || m.Message == "" {
+		return nil
+	}
+
+	runes := []rune(m.Message)
+	// u16[i] это смещение i-й руны в UTF-16
+	u16 := make([]int, len(runes)+1)
+	for i, r := range runes {
+		u16[i+1] = u16[i] + utf16.RuneLen(r)
+	}
+	toRune := func(off int) int {
+		return sort.SearchInts(u16, off)
+	}
+
+	out := make([]storage.HitEntity, 0, len(m.Entities))
+	for _, e := range m.Entities {
+		from, length := e.GetOffset(), e.GetLength()
+		if from < 0 || length <= 0 || from+length > u16[len(runes)] {
+			continue
+		}
+
+		ent := storage.HitEntity{
+			Start: toRune(from),
+			End:   toRune(from + length),
+		}
+		if ent.End <= ent.Start {
+			continue
+		}
+		text := string(runes[ent.Start:ent.End])
+
+		switch v := e.(type) {
+		case *tg.MessageEntityURL:
+			ent.Type = "url"
+			ent.Value = text
+			ent.Domain = linkDomain(text)
+		case *tg.MessageEntityTextURL:
+			ent.Type = "text_url"
+			ent.Value = v.URL
+			ent.Domain = linkDomain(v.URL)
+		case *tg.MessageEntityMention:
+			ent.Type = "mention"
+			ent.Value = strings.ToLower(strings.TrimPrefix(text, "@"))
+		case *tg.MessageEntityMentionName:
+			ent.Type = "mention_name"
+			ent.Value = "user:" + strconv.FormatInt(v.UserID, 10)
+		case *tg.MessageEntityHashtag:
+			ent.Type = "hashtag"
+			ent.Value = strings.ToLower(strings.TrimPrefix(text, "#"))
+		case *tg.MessageEntityCashtag:
+			ent.Type = "cashtag"
+			ent.Value = strings.ToUpper(strings.TrimPrefix(text, "$"))
+		case *tg.MessageEntityEmail:
+			ent.Type = "email"
+			ent.Value = strings.ToLower(text)
+		case *tg.MessageEntityPre:
+			ent.Type = "pre"
+			ent.Value = v.Language
+		case *tg.MessageEntityCustomEmoji, *tg.MessageEntityUnknown:
+			continue
+		default:
+			// messageEntityBold -> bold и т.п.
+			ent.Type = strings.ToLower(strings.TrimPrefix(e.TypeName(), "messageEntity"))
+		}
+
+		out = append(out, ent)
+	}
+	return out
+}
+
+// linkDomain это хост ссылки в нижнем регистре без www., пусто если не разобрали
+// у ссылок из текста схемы часто нет (rbc.ru/news/...)
+func linkDomain(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		if strings.HasPrefix(strings.ToLower(raw), "mailto:") || strings.HasPrefix(strings.ToLower(raw), "tg:") {
+			return ""
+		}
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if !strings.Contains(host, ".") {
+		return ""
+	}
+	return host
+}
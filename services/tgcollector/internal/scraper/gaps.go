@@ -0,0 +1,119 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// gapStats это итог дозаполнения дыр за один проход по каналу
+type gapStats struct {
+	scanned int
+	hitsNew int
+	// left это сколько дыр осталось открытыми после прохода
+	left int
+}
+
+// fillGaps дочитывает непросмотренные диапазоны за чекпоинтом, начиная с самых свежих
+// на это отдельный бюджет в per_channel_max_scan сообщений, чтобы свежие сообщения
+// не ждали, пока разгребется старый завал
+//
+// сообщения старше lookback уже не нужны, дыра с ними просто закрывается
+func (s *Scraper) fillGaps(ctx context.Context, api *tg.Client, key string, ch *channelPeer, g *channelGroup, cutoff time.Time) (gapStats, error) {
+	var st gapStats
+
+	gaps, err := s.store.ListScanGaps(ctx, key)
+	if err != nil {
+		return st, fmt.Errorf("list scan gaps %s: %w", ch.name, err)
+	}
+
+	const batchLimit = 100
+
+	for i, gap := range gaps {
+		if st.scanned >= g.perChannelMaxScan {
+			st.left += len(gaps) - i
+			break
+		}
+
+		top := gap.ToID
+		closed := false
+
+		for !closed && st.scanned < g.perChannelMaxScan {
+			if err := sleepCtx(ctx, g.minDelay); err != nil {
+				return st, err
+			}
+
+			// offset_id отдает сообщения строго младше, поэтому +1, чтобы захватить сам to_id
+			res, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+				Peer:     ch.peer,
+				Limit:    batchLimit,
+				OffsetID: int(top + 1),
+			})
+			if err != nil {
+				return st, fmt.Errorf("gap history(%s, offset=%d): %w", ch.name, top+1, err)
+			}
+
+			msgs := extractMessages(res)
+			if len(msgs) == 0 {
+				closed = true
+				break
+			}
+			prevTop := top
+
+			for _, mc := range msgs {
+				// бюджет кончился посреди пачки: top стоит на последнем разобранном,
+				// остаток дыры дочитается в следующий проход
+				if st.scanned >= g.perChannelMaxScan {
+					break
+				}
+				id := int64(mc.GetID())
+				if id < gap.FromID {
+					closed = true
+					break
+				}
+				st.scanned++
+				if id <= top {
+					top = id - 1
+				}
+
+				m, ok := mc.(*tg.Message)
+				if !ok {
+					continue
+				}
+				if !cutoff.IsZero() && time.Unix(int64(m.Date), 0).Before(cutoff) {
+					closed = true
+					break
+				}
+
+				r, err := s.processMessage(ctx, api, ch, g, m, false)
+				if err != nil {
+					return st, err
+				}
+				if r == storage.SaveInserted {
+					st.hitsNew++
+				}
+			}
+
+			if !closed && top == prevTop {
+				// Telegram вернул то же самое, дыру оставляем до следующего прохода
+				break
+			}
+		}
+
+		if closed {
+			top = gap.FromID - 1
+		}
+		if err := s.store.UpdateScanGap(ctx, gap.ID, top); err != nil {
+			return st, fmt.Errorf("update scan gap %s: %w", ch.name, err)
+		}
+		if top >= gap.FromID {
+			st.left++
+		}
+	}
+
+	return st, nil
+}
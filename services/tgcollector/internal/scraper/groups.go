@@ -0,0 +1,160 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/keywords"
+)
+
+const DefaultGroup = "default"
+
+// GroupConfig переопределяет настройки обхода для своих каналов
+// нулевые поля наследуются из Config, пустой Keywords тоже
+type GroupConfig struct {
+	Name        string
+	Channels    []string
+	Keywords    []string
+	KeywordMode string
+
+	Lookback             time.Duration
+	PerChannelMaxScan    int
+	MinDelay             time.Duration
+	BetweenChannelsDelay time.Duration
+}
+
+// channelGroup это группа с уже разрешенными настройками и своим набором выражений
+type channelGroup struct {
+	name string
+	mode keywords.Mode
+
+	// из конфига, используются пока в БД пусто
+	channels []string
+	keywords []string
+
+	lookback             time.Duration
+	perChannelMaxScan    int
+	minDelay             time.Duration
+	betweenChannelsDelay time.Duration
+
+	matcher     *keywords.Matcher
+	keywordsKey string
+}
+
+// channelJob это один канал в очереди обхода вместе с его группой
+// src пустой, если ref не разобрался, такой канал crawlJob отметит как ошибку
+type channelJob struct {
+	ref   string
+	src   source
+	group *channelGroup
+}
+
+func buildGroups(cfg Config) ([]*channelGroup, error) {
+	base := GroupConfig{
+		Name:                 DefaultGroup,
+		Channels:             cfg.Channels,
+		Keywords:             cfg.Keywords,
+		KeywordMode:          cfg.KeywordMode,
+		Lookback:             cfg.Lookback,
+		PerChannelMaxScan:    cfg.PerChannelMaxScan,
+		MinDelay:             cfg.MinDelay,
+		BetweenChannelsDelay: cfg.BetweenChannelsDelay,
+	}
+
+	def, err := newChannelGroup(base, base)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*channelGroup{def}
+	seen := map[string]struct{}{DefaultGroup: {}}
+
+	for _, gc := range cfg.Groups {
+		gc.Name = normalizeGroupName(gc.Name)
+		if _, ok := seen[gc.Name]; ok {
+			return nil, fmt.Errorf("scraper: duplicate group %q", gc.Name)
+		}
+		seen[gc.Name] = struct{}{}
+
+		g, err := newChannelGroup(gc, base)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+
+	return out, nil
+}
+
+func newChannelGroup(gc GroupConfig, base GroupConfig) (*channelGroup, error) {
+	if len(gc.Keywords) == 0 {
+		gc.Keywords = base.Keywords
+	}
+	if gc.KeywordMode == "" {
+		gc.KeywordMode = base.KeywordMode
+	}
+	if gc.Lookback <= 0 {
+		gc.Lookback = base.Lookback
+	}
+	if gc.PerChannelMaxScan <= 0 {
+		gc.PerChannelMaxScan = base.PerChannelMaxScan
+	}
+	if gc.MinDelay <= 0 {
+		gc.MinDelay = base.MinDelay
+	}
+	if gc.BetweenChannelsDelay <= 0 {
+		gc.BetweenChannelsDelay = base.BetweenChannelsDelay
+	}
+
+	mode, err := keywords.ParseMode(gc.KeywordMode)
+	if err != nil {
+		return nil, fmt.Errorf("scraper: group %q: %w", gc.Name, err)
+	}
+
+	g := &channelGroup{
+		name:                 gc.Name,
+		mode:                 mode,
+		channels:             gc.Channels,
+		keywords:             gc.Keywords,
+		lookback:             gc.Lookback,
+		perChannelMaxScan:    gc.PerChannelMaxScan,
+		minDelay:             gc.MinDelay,
+		betweenChannelsDelay: gc.BetweenChannelsDelay,
+	}
+
+	// у группы по умолчанию может не быть своих выражений, если все каналы разложены по группам
+	if len(gc.Keywords) > 0 {
+		if err := g.setKeywords(gc.Keywords); err != nil {
+			return nil, fmt.Errorf("scraper: group %q: %w", gc.Name, err)
+		}
+	}
+
+	return g, nil
+}
+
+// setKeywords перекомпилирует выражения группы, если набор поменялся
+// при ошибке группа остается на прошлом наборе
+func (g *channelGroup) setKeywords(exprs []string) error {
+	key := strings.Join(exprs, "\n")
+	if g.matcher != nil && key == g.keywordsKey {
+		return nil
+	}
+
+	m, err := keywords.Compile(exprs, g.mode)
+	if err != nil {
+		return err
+	}
+
+	g.matcher = m
+	g.keywordsKey = key
+	return nil
+}
+
+func normalizeGroupName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return DefaultGroup
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// HealthConfig это карантин для каналов, которые падают раз за разом
+// после QuarantineAfter неудач подряд канал пропускается на BackoffBase,
+// дальше пауза удваивается с каждой новой неудачей, но не больше BackoffMax
+type HealthConfig struct {
+	QuarantineAfter int
+	BackoffBase     time.Duration
+	BackoffMax      time.Duration
+}
+
+// quarantineBackoff считает паузу по числу неудач подряд, 0 значит карантин не нужен
+func (c HealthConfig) quarantineBackoff(failures int) time.Duration {
+	if c.QuarantineAfter <= 0 || failures < c.QuarantineAfter {
+		return 0
+	}
+
+	d := c.BackoffBase
+	for i := c.QuarantineAfter; i < failures; i++ {
+		d *= 2
+		if d >= c.BackoffMax {
+			return c.BackoffMax
+		}
+	}
+	return min(d, c.BackoffMax)
+}
+
+// loadQuarantined не валит обход: без таблицы здоровья просто обходим все каналы
+func (s *Scraper) loadQuarantined(ctx context.Context) map[string]time.Time {
+	q, err := s.store.ListQuarantined(ctx, time.Now())
+	if err != nil {
+		s.log.Warn("load quarantined channels failed", slog.Any("err", err))
+		return nil
+	}
+	return q
+}
+
+func (s *Scraper) recordSuccess(ctx context.Context, channel, stopReason string) {
+	if err := s.store.RecordChannelSuccess(ctx, channel, stopReason); err != nil {
+		s.log.Warn("record channel success failed",
+			slog.String("channel", channel),
+			slog.Any("err", err),
+		)
+	}
+}
+
+func (s *Scraper) recordFailure(ctx context.Context, channel string, scanErr error) {
+	failures, err := s.store.RecordChannelFailure(ctx, channel, scanErr.Error())
+	if err != nil {
+		s.log.Warn("record channel failure failed",
+			slog.String("channel", channel),
+			slog.Any("err", err),
+		)
+		return
+	}
+
+	backoff := s.cfg.Health.quarantineBackoff(failures)
+	if backoff <= 0 {
+		return
+	}
+
+	until := time.Now().Add(backoff)
+	if err := s.store.QuarantineChannel(ctx, channel, until); err != nil {
+		s.log.Warn("quarantine channel failed",
+			slog.String("channel", channel),
+			slog.Any("err", err),
+		)
+		return
+	}
+
+	s.log.Warn("channel quarantined",
+		slog.String("channel", channel),
+		slog.Int("consecutive_failures", failures),
+		slog.Duration("backoff", backoff),
+		slog.Time("until", until.UTC()),
+	)
+}
@@ -2,74 +2,38 @@ package scraper
 
 import (
 	"context"
-	"fmt"
-	"strings"
 	"time"
 
 	"github.com/gotd/td/tg"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/keywords"
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
 )
 
-func normalizeKeywords(in []string) []string {
-	out := make([]string, 0, len(in))
-	seen := map[string]struct{}{}
-	for _, k := range in {
-		k = strings.ToLower(strings.TrimSpace(k))
-		if k == "" {
-			continue
-		}
-		if _, ok := seen[k]; ok {
-			continue
+func toHitKeywords(matches []keywords.Match) []storage.HitKeyword {
+	out := make([]storage.HitKeyword, 0, len(matches))
+	for _, m := range matches {
+		spans := make([]storage.Span, 0, len(m.Spans))
+		for _, sp := range m.Spans {
+			spans = append(spans, storage.Span{Start: sp.Start, End: sp.End})
 		}
-		seen[k] = struct{}{}
-		out = append(out, k)
+		out = append(out, storage.HitKeyword{Keyword: m.Keyword, Spans: spans})
 	}
 	return out
 }
 
-func containsAnyKeyword(text string, keywords []string) (string, bool) {
-	s := strings.ToLower(text)
-	for _, k := range keywords {
-		if k != "" && strings.Contains(s, k) {
-			return k, true
+// clipHitKeywords отбрасывает позиции за пределами текста hit (совпадения в метаданных)
+func clipHitKeywords(in []storage.HitKeyword, textRunes int) []storage.HitKeyword {
+	for i := range in {
+		spans := in[i].Spans[:0]
+		for _, sp := range in[i].Spans {
+			if sp.End <= textRunes {
+				spans = append(spans, sp)
+			}
 		}
+		in[i].Spans = spans
 	}
-	return "", false
-}
-
-func normalizeUsername(s string) string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return ""
-	}
-	if strings.HasPrefix(s, "@") {
-		return strings.TrimPrefix(s, "@")
-	}
-	s = strings.TrimPrefix(s, "https://")
-	s = strings.TrimPrefix(s, "http://")
-	if strings.HasPrefix(s, "t.me/") {
-		return strings.TrimPrefix(s, "t.me/")
-	}
-	if strings.HasPrefix(s, "telegram.me/") {
-		return strings.TrimPrefix(s, "telegram.me/")
-	}
-	return ""
-}
-
-func ResolvePublicChannel(ctx context.Context, api *tg.Client, username string) (tg.InputPeerClass, string, error) {
-	r, err := api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: username})
-	if err != nil {
-		return nil, "", fmt.Errorf("resolve @%s: %w", username, err)
-	}
-
-	for _, cc := range r.Chats {
-		ch, ok := cc.(*tg.Channel)
-		if !ok {
-			continue
-		}
-		return &tg.InputPeerChannel{ChannelID: ch.ID, AccessHash: ch.AccessHash}, "https://t.me/" + username, nil
-	}
-
-	return nil, "", fmt.Errorf("resolve @%s: channel not found", username)
+	return in
 }
 
 func extractMessages(res tg.MessagesMessagesClass) []tg.MessageClass {
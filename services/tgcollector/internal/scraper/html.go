@@ -0,0 +1,165 @@
+package scraper
+
+import (
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// htmlTag это открывающий и закрывающий тег для одной HitEntity
+type htmlTag struct {
+	open  string
+	close string
+	// raw: внутри code/pre Bot API другой разметки не принимает
+	raw bool
+}
+
+// entityTag переводит разметку в тег из тех, что понимает Bot API (parse_mode=HTML)
+// ok = false для разметки, которая остается простым текстом (url, хештеги, упоминания)
+func entityTag(e storage.HitEntity) (htmlTag, bool) {
+	switch e.Type {
+	case "bold":
+		return htmlTag{open: "<b>", close: "</b>"}, true
+	case "italic":
+		return htmlTag{open: "<i>", close: "</i>"}, true
+	case "underline":
+		return htmlTag{open: "<u>", close: "</u>"}, true
+	case "strike":
+		return htmlTag{open: "<s>", close: "</s>"}, true
+	case "spoiler":
+		return htmlTag{open: "<tg-spoiler>", close: "</tg-spoiler>"}, true
+	case "blockquote":
+		return htmlTag{open: "<blockquote>", close: "</blockquote>"}, true
+	case "code":
+		return htmlTag{open: "<code>", close: "</code>", raw: true}, true
+	case "pre":
+		if lang := strings.TrimSpace(e.Value); lang != "" && !strings.ContainsAny(lang, "\"<>& ") {
+			return htmlTag{open: `<pre><code class="language-` + lang + `">`, close: "</code></pre>", raw: true}, true
+		}
+		return htmlTag{open: "<pre>", close: "</pre>", raw: true}, true
+	case "text_url":
+		if !safeHref(e.Value) {
+			return htmlTag{}, false
+		}
+		return htmlTag{open: `<a href="` + html.EscapeString(e.Value) + `">`, close: "</a>"}, true
+	case "mention_name":
+		id, ok := strings.CutPrefix(e.Value, "user:")
+		if !ok || id == "" {
+			return htmlTag{}, false
+		}
+		return htmlTag{open: `<a href="tg://user?id=` + id + `">`, close: "</a>"}, true
+	}
+	return htmlTag{}, false
+}
+
+// safeHref пропускает только схемы, которые Bot API точно примет:
+// из-за одной кривой ссылки sendMessage отклонит все сообщение
+func safeHref(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "tg", "mailto":
+		return true
+	}
+	return false
+}
+
+// entitiesHTML собирает из текста и разметки HTML для parse_mode=HTML
+// пусто, если в разметке нет ничего, что стоит рисовать: тогда хватит простого текста
+//
+// в Telegram разметка может пересекаться (жирный начался внутри ссылки, а кончился после),
+// а в HTML теги должны вкладываться, поэтому при закрытии тега, который не сверху,
+// теги над ним закрываются и сразу открываются заново
+func entitiesHTML(text string, entities []storage.HitEntity) string {
+	type span struct {
+		start, end int
+		tag        htmlTag
+	}
+
+	runes := []rune(text)
+	spans := make([]span, 0, len(entities))
+	for _, e := range entities {
+		if e.Start < 0 || e.End > len(runes) || e.End <= e.Start {
+			continue
+		}
+		if tag, ok := entityTag(e); ok {
+			spans = append(spans, span{start: e.Start, end: e.End, tag: tag})
+		}
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	// снаружи длинные: при общем начале первым открывается тот, что дольше
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+
+	var (
+		b     strings.Builder
+		stack []span
+		next  int
+	)
+	rawOpen := func() bool {
+		for _, s := range stack {
+			if s.tag.raw {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i <= len(runes); i++ {
+		// закрываем все, что кончается здесь
+		for {
+			idx := -1
+			for k := len(stack) - 1; k >= 0; k-- {
+				if stack[k].end <= i {
+					idx = k
+					break
+				}
+			}
+			if idx < 0 {
+				break
+			}
+			for k := len(stack) - 1; k >= idx; k-- {
+				b.WriteString(stack[k].tag.close)
+			}
+			reopen := append([]span(nil), stack[idx+1:]...)
+			stack = stack[:idx]
+			for _, s := range reopen {
+				if s.end > i {
+					b.WriteString(s.tag.open)
+					stack = append(stack, s)
+				}
+			}
+		}
+
+		if i == len(runes) {
+			break
+		}
+
+		for ; next < len(spans) && spans[next].start <= i; next++ {
+			s := spans[next]
+			if s.start < i || rawOpen() {
+				continue
+			}
+			b.WriteString(s.tag.open)
+			stack = append(stack, s)
+		}
+
+		b.WriteString(html.EscapeString(string(runes[i])))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,286 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// MediaConfig это локальное скачивание фото и документов из hits
+// файлы кладутся в Dir/<первые 2 символа sha256>/<sha256><ext>, одинаковые файлы не дублируются
+type MediaConfig struct {
+	Enabled        bool
+	Dir            string
+	MaxFileBytes   int64
+	RunBudgetBytes int64
+}
+
+var errMediaTooLarge = errors.New("media file exceeds max_file_bytes")
+
+type mediaFetcher struct {
+	dir          string
+	maxFileBytes int64
+	runBudget    int64
+	dl           *downloader.Downloader
+
+	mu   sync.Mutex
+	used int64
+}
+
+func newMediaFetcher(c MediaConfig) (*mediaFetcher, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("scraper: media dir: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("scraper: create media dir: %w", err)
+	}
+
+	return &mediaFetcher{
+		dir:          dir,
+		maxFileBytes: c.MaxFileBytes,
+		runBudget:    c.RunBudgetBytes,
+		dl:           downloader.NewDownloader(),
+	}, nil
+}
+
+// resetBudget вызывается в начале каждого обхода
+func (f *mediaFetcher) resetBudget() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.used = 0
+}
+
+// reserve забирает size байт из бюджета обхода, false если бюджета не хватает
+func (f *mediaFetcher) reserve(size int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.runBudget > 0 && f.used+size > f.runBudget {
+		return false
+	}
+	f.used += size
+	return true
+}
+
+func (f *mediaFetcher) release(size int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.used -= size
+}
+
+// mediaFile это то, что и откуда качать
+type mediaFile struct {
+	kind     string
+	location tg.InputFileLocationClass
+	size     int64
+	mimeType string
+	fileName string
+}
+
+// pickMediaFile выбирает файл из медиа сообщения: самый большой размер фото
+// или сам документ. Остальные виды медиа не качаем
+func pickMediaFile(m *tg.Message) (mediaFile, bool) {
+	media, ok := m.GetMedia()
+	if !ok {
+		return mediaFile{}, false
+	}
+
+	switch v := media.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, ok := v.Photo.(*tg.Photo)
+		if !ok {
+			return mediaFile{}, false
+		}
+		sizeType, size := largestPhotoSize(photo.Sizes)
+		if sizeType == "" {
+			return mediaFile{}, false
+		}
+		return mediaFile{
+			kind: "photo",
+			location: &tg.InputPhotoFileLocation{
+				ID:            photo.ID,
+				AccessHash:    photo.AccessHash,
+				FileReference: photo.FileReference,
+				ThumbSize:     sizeType,
+			},
+			size:     int64(size),
+			mimeType: "image/jpeg",
+		}, true
+
+	case *tg.MessageMediaDocument:
+		doc, ok := v.Document.(*tg.Document)
+		if !ok {
+			return mediaFile{}, false
+		}
+		f := mediaFile{
+			kind: "document",
+			location: &tg.InputDocumentFileLocation{
+				ID:            doc.ID,
+				AccessHash:    doc.AccessHash,
+				FileReference: doc.FileReference,
+			},
+			size:     doc.Size,
+			mimeType: doc.MimeType,
+		}
+		for _, attr := range doc.Attributes {
+			if fn, ok := attr.(*tg.DocumentAttributeFilename); ok {
+				f.fileName = fn.FileName
+			}
+		}
+		return f, true
+	}
+
+	return mediaFile{}, false
+}
+
+func largestPhotoSize(sizes []tg.PhotoSizeClass) (string, int) {
+	var (
+		bestType string
+		bestSize int
+	)
+	for _, sc := range sizes {
+		switch v := sc.(type) {
+		case *tg.PhotoSize:
+			if v.Size > bestSize {
+				bestType, bestSize = v.Type, v.Size
+			}
+		case *tg.PhotoSizeProgressive:
+			if n := len(v.Sizes); n > 0 && v.Sizes[n-1] > bestSize {
+				bestType, bestSize = v.Type, v.Sizes[n-1]
+			}
+		}
+	}
+	return bestType, bestSize
+}
+
+// downloadedMedia это скачанный во временный файл медиа, который еще не лежит по своему пути
+type downloadedMedia struct {
+	media storage.HitMedia
+	tmp   string
+}
+
+// place переносит файл на место, если там его еще нет
+// вызывается под блокировкой пути в SaveHitMedia: retention мог удалить
+// файл с тем же sha256 сразу перед нами, тогда он появится снова
+func (d *downloadedMedia) place() error {
+	if _, err := os.Stat(d.media.Path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(d.media.Path), 0o755); err != nil {
+		return fmt.Errorf("create media subdir: %w", err)
+	}
+	if err := os.Rename(d.tmp, d.media.Path); err != nil {
+		return fmt.Errorf("store media file: %w", err)
+	}
+	return nil
+}
+
+// discard убирает временный файл, если place его не забрал
+func (d *downloadedMedia) discard() {
+	_ = os.Remove(d.tmp)
+}
+
+// fetch скачивает медиа сообщения во временный файл, nil без ошибки значит качать нечего
+// или файл не влезает в лимиты. На место файл кладет place, после он discard
+func (f *mediaFetcher) fetch(ctx context.Context, api *tg.Client, m *tg.Message) (*downloadedMedia, error) {
+	file, ok := pickMediaFile(m)
+	if !ok {
+		return nil, nil
+	}
+	if f.maxFileBytes > 0 && file.size > f.maxFileBytes {
+		return nil, nil
+	}
+	if !f.reserve(file.size) {
+		return nil, nil
+	}
+
+	tmp, err := os.CreateTemp(f.dir, ".download-*")
+	if err != nil {
+		f.release(file.size)
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := &hashingWriter{w: tmp, h: sha256.New(), limit: f.maxFileBytes}
+	_, err = f.dl.Download(api, file.location).Stream(ctx, w)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	// в бюджет засчитываем то, что реально скачали
+	f.release(file.size - w.n)
+	if err != nil {
+		if errors.Is(err, errMediaTooLarge) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("download %s: %w", file.kind, err)
+	}
+
+	sum := hex.EncodeToString(w.h.Sum(nil))
+	keep = true
+
+	return &downloadedMedia{
+		media: storage.HitMedia{
+			Kind:      file.kind,
+			MimeType:  file.mimeType,
+			FileName:  file.fileName,
+			SizeBytes: w.n,
+			SHA256:    sum,
+			Path:      filepath.Join(f.dir, sum[:2], sum+mediaExt(file)),
+		},
+		tmp: tmp.Name(),
+	}, nil
+}
+
+func mediaExt(f mediaFile) string {
+	if ext := strings.ToLower(filepath.Ext(f.fileName)); ext != "" && len(ext) <= 8 {
+		return ext
+	}
+	if f.kind == "photo" {
+		return ".jpg"
+	}
+	if exts, err := mime.ExtensionsByType(f.mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// hashingWriter считает sha256 на лету и обрывает загрузку после limit байт
+type hashingWriter struct {
+	w     io.Writer
+	h     hash.Hash
+	n     int64
+	limit int64
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	if hw.limit > 0 && hw.n+int64(len(p)) > hw.limit {
+		return 0, errMediaTooLarge
+	}
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	hw.n += int64(n)
+	return n, err
+}
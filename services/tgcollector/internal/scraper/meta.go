@@ -0,0 +1,125 @@
+package scraper
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// messageMeta вытаскивает из сообщения медиа, превью ссылки, репост и счетчики
+func messageMeta(m *tg.Message) (storage.HitMeta, storage.HitStats) {
+	var (
+		meta  storage.HitMeta
+		stats storage.HitStats
+	)
+
+	if media, ok := m.GetMedia(); ok {
+		fillMediaMeta(&meta, media)
+	}
+
+	if fwd, ok := m.GetFwdFrom(); ok {
+		meta.FwdFrom = fwdSource(fwd)
+		meta.FwdChannelPost = fwd.ChannelPost
+	}
+	if author, ok := m.GetPostAuthor(); ok {
+		meta.PostAuthor = author
+	}
+	meta.GroupedID = m.GroupedID
+
+	if v, ok := m.GetViews(); ok {
+		stats.Views = &v
+	}
+	if v, ok := m.GetForwards(); ok {
+		stats.Forwards = &v
+	}
+	if r, ok := m.GetReactions(); ok {
+		total := 0
+		for _, rc := range r.Results {
+			total += rc.Count
+		}
+		stats.Reactions = &total
+	}
+	if r, ok := m.GetReplies(); ok {
+		meta.Replies = r.Replies
+	}
+
+	return meta, stats
+}
+
+func fillMediaMeta(meta *storage.HitMeta, media tg.MessageMediaClass) {
+	switch v := media.(type) {
+	case *tg.MessageMediaPhoto:
+		meta.MediaType = "photo"
+
+	case *tg.MessageMediaDocument:
+		meta.MediaType = "document"
+		switch {
+		case v.Video:
+			meta.MediaType = "video"
+		case v.Round:
+			meta.MediaType = "round"
+		case v.Voice:
+			meta.MediaType = "voice"
+		}
+		if doc, ok := v.Document.(*tg.Document); ok {
+			meta.MimeType = doc.MimeType
+			for _, attr := range doc.Attributes {
+				if fn, ok := attr.(*tg.DocumentAttributeFilename); ok {
+					meta.FileName = fn.FileName
+				}
+			}
+		}
+
+	case *tg.MessageMediaWebPage:
+		meta.MediaType = "webpage"
+		if wp, ok := v.Webpage.(*tg.WebPage); ok {
+			meta.WebPageURL = wp.URL
+			meta.WebPageSite = wp.SiteName
+			meta.WebPageTitle = wp.Title
+			meta.WebPageDescription = wp.Description
+		}
+
+	case *tg.MessageMediaPoll:
+		meta.MediaType = "poll"
+		meta.PollQuestion = v.Poll.Question.Text
+
+	default:
+		// messageMediaGeo -> geo и т.п.
+		meta.MediaType = strings.ToLower(strings.TrimPrefix(media.TypeName(), "messageMedia"))
+	}
+}
+
+func fwdSource(fwd tg.MessageFwdHeader) string {
+	if fwd.FromName != "" {
+		return fwd.FromName
+	}
+	switch p := fwd.FromID.(type) {
+	case *tg.PeerChannel:
+		return "channel:" + strconv.FormatInt(p.ChannelID, 10)
+	case *tg.PeerUser:
+		return "user:" + strconv.FormatInt(p.UserID, 10)
+	case *tg.PeerChat:
+		return "chat:" + strconv.FormatInt(p.ChatID, 10)
+	}
+	return ""
+}
+
+// metaText это текстовые поля метаданных, по которым тоже ищем ключевые слова
+func metaText(meta storage.HitMeta) string {
+	parts := make([]string, 0, 5)
+	for _, p := range []string{
+		meta.FileName,
+		meta.WebPageTitle,
+		meta.WebPageDescription,
+		meta.WebPageSite,
+		meta.PollQuestion,
+	} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,202 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/gotd/td/tg"
+
+	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// AttachRealtimeAccount задает аккаунт потока обновлений, через него обработчики качают медиа
+// вызывать до запуска потока обновлений
+func (s *Scraper) AttachRealtimeAccount(acc *mtclient.Account) {
+	s.realtimeAcc = acc
+}
+
+// HandleNewChannelMessage обрабатывает новое сообщение из потока обновлений MTProto
+//
+// обновления приходят только по каналам, на которые подписан аккаунт сессии.
+// Сообщения из каналов, которых нет в текущем наборе источников, пропускаются.
+// Чекпоинт здесь не двигаем: обычный обход остается страховкой от пропусков,
+// а повторное сохранение того же сообщения SaveHit просто проигнорирует
+func (s *Scraper) HandleNewChannelMessage(ctx context.Context, e tg.Entities, u *tg.UpdateNewChannelMessage) error {
+	s.handleChannelMessage(ctx, e, u.Message)
+	return nil
+}
+
+// HandleEditChannelMessage обрабатывает правку сообщения из потока обновлений
+func (s *Scraper) HandleEditChannelMessage(ctx context.Context, e tg.Entities, u *tg.UpdateEditChannelMessage) error {
+	s.handleChannelMessage(ctx, e, u.Message)
+	return nil
+}
+
+// HandleDeleteChannelMessages помечает удаленными hits, о которых пришло обновление
+// канал ищем только по id, запомненному при обходе: entities в таком обновлении пустые
+func (s *Scraper) HandleDeleteChannelMessages(ctx context.Context, e tg.Entities, u *tg.UpdateDeleteChannelMessages) error {
+	s.mu.RLock()
+	known, ok := s.channelIDs[u.ChannelID]
+	s.mu.RUnlock()
+	if !ok || len(u.Messages) == 0 {
+		return nil
+	}
+	channel := known.peer.name
+
+	ids := make([]int64, 0, len(u.Messages))
+	for _, id := range u.Messages {
+		ids = append(ids, int64(id))
+	}
+
+	marked, err := s.store.MarkDeleted(ctx, channel, ids)
+	if err != nil {
+		s.log.Error("realtime delete failed",
+			slog.String("channel", channel),
+			slog.Any("err", err),
+		)
+		return nil
+	}
+	if marked > 0 {
+		s.log.Info("realtime hits deleted",
+			slog.String("channel", channel),
+			slog.Int("deleted", marked),
+		)
+	}
+	return nil
+}
+
+func (s *Scraper) handleChannelMessage(ctx context.Context, e tg.Entities, msg tg.MessageClass) {
+	m, ok := msg.(*tg.Message)
+	if !ok {
+		return
+	}
+	peer, ok := m.PeerID.(*tg.PeerChannel)
+	if !ok {
+		return
+	}
+
+	// под локом только ищем канал: processMessage ходит в БД и качает медиа,
+	// а refreshSources и rememberChannel ждали бы его на s.mu.Lock.
+	// Группу копируем, потому что refreshSources может заменить ей matcher
+	s.mu.RLock()
+	job, ch, ok := s.lookupJob(peer.ChannelID, e)
+	var g channelGroup
+	if ok {
+		g = *job.group
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	api, ch := s.realtimePeer(ctx, job.src, ch)
+
+	res, err := s.processMessage(ctx, api, ch, &g, m, false)
+	if err != nil {
+		s.log.Error("realtime message failed",
+			slog.String("channel", ch.name),
+			slog.Int("message_id", m.ID),
+			slog.Any("err", err),
+		)
+		return
+	}
+
+	switch res {
+	case storage.SaveInserted:
+		s.log.Info("realtime hit saved",
+			slog.String("channel", ch.name),
+			slog.String("group", g.name),
+			slog.Int("message_id", m.ID),
+		)
+	case storage.SaveUpdated:
+		s.log.Info("realtime hit edited",
+			slog.String("channel", ch.name),
+			slog.String("group", g.name),
+			slog.Int("message_id", m.ID),
+		)
+	}
+}
+
+// realtimePeer отдает клиента аккаунта потока и канал с его access_hash
+//
+// канал из lookupJob мог найти при обходе другой аккаунт пула, а access_hash у каждого
+// аккаунта свой: с чужим скачивание медиа получит CHANNEL_INVALID. Поэтому канал
+// берется через resolveSource для аккаунта потока (обычно из кэша).
+// Не вышло -> hit все равно сохраняем по fallback, но без медиа
+func (s *Scraper) realtimePeer(ctx context.Context, src source, fallback *channelPeer) (*tg.Client, *channelPeer) {
+	acc := s.realtimeAcc
+	if acc == nil || src.key() == "" {
+		return nil, fallback
+	}
+
+	p, err := s.resolveSource(ctx, acc, src)
+	if err != nil {
+		s.log.Warn("realtime resolve failed, media skipped",
+			slog.String("channel", fallback.name),
+			slog.String("account", acc.Name),
+			slog.Any("err", err),
+		)
+		return nil, fallback
+	}
+	return acc.API(), p
+}
+
+// knownChannel это канал, уже найденный при обходе: index указывает на источник в bySource
+type knownChannel struct {
+	index string
+	peer  *channelPeer
+}
+
+// lookupJob ищет канал сначала по id, который запомнили при обходе,
+// потом как приватный источник по id и по username из entities самого обновления.
+// Вызывать под s.mu
+func (s *Scraper) lookupJob(channelID int64, e tg.Entities) (channelJob, *channelPeer, bool) {
+	if known, ok := s.channelIDs[channelID]; ok {
+		if job, ok := s.bySource[known.index]; ok {
+			return job, known.peer, true
+		}
+	}
+
+	ch, hasEntity := e.Channels[channelID]
+
+	if job, ok := s.bySource[privateChannelName(channelID)]; ok {
+		if hasEntity {
+			return job, peerFromChannel(ch), true
+		}
+		name := privateChannelName(channelID)
+		return job, &channelPeer{
+			peer:     &tg.InputPeerChannel{ChannelID: channelID},
+			name:     name,
+			linkBase: "https://t.me/" + name,
+		}, true
+	}
+	if !hasEntity {
+		return channelJob{}, nil, false
+	}
+
+	names := make([]string, 0, 1+len(ch.Usernames))
+	if ch.Username != "" {
+		names = append(names, ch.Username)
+	}
+	for _, un := range ch.Usernames {
+		if un.Active {
+			names = append(names, un.Username)
+		}
+	}
+
+	for _, name := range names {
+		if job, ok := s.bySource[strings.ToLower(name)]; ok {
+			p := &tg.InputPeerChannel{ChannelID: ch.ID, AccessHash: ch.AccessHash}
+			return job, publicPeer(p, job.src.username), true
+		}
+	}
+	return channelJob{}, nil, false
+}
+
+func (s *Scraper) rememberChannel(channelID int64, src source, ch *channelPeer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelIDs[channelID] = knownChannel{index: src.index(), peer: ch}
+}
@@ -0,0 +1,163 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// refreshSources перечитывает каналы и ключевые выражения из БД перед каждым обходом
+// и раскладывает каналы по группам
+//
+// пустая таблица значит "берем из конфига", для keywords это решается по каждой группе.
+// Каналов может не быть ни там, ни там (их еще не завели в БД), тогда обход пустой.
+// Если БД недоступна или новые выражения не компилируются, продолжаем на прошлом наборе
+func (s *Scraper) refreshSources(ctx context.Context) []channelJob {
+	reg, err := s.store.LoadRegistry(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.log.Warn("load registry failed, using previous sources", slog.Any("err", err))
+		if s.jobs == nil {
+			s.setJobs(s.planJobs(s.configChannels(), nil, "config"))
+		}
+		return s.jobs
+	}
+
+	channelsFrom := "db"
+	channels := reg.Channels
+	if len(channels) == 0 {
+		channelsFrom = "config"
+		channels = s.configChannels()
+	}
+
+	if len(channels) == 0 {
+		s.log.Warn("no channels in db or config, nothing to crawl")
+	}
+
+	s.setJobs(s.planJobs(channels, reg.Keywords, channelsFrom))
+	return s.jobs
+}
+
+func (s *Scraper) setJobs(jobs []channelJob) {
+	s.jobs = jobs
+	s.bySource = make(map[string]channelJob, len(jobs))
+	for _, job := range jobs {
+		if job.src.key() != "" {
+			s.bySource[job.src.index()] = job
+		}
+	}
+}
+
+func (s *Scraper) planJobs(channels []storage.RegistryItem, keywordItems []storage.RegistryItem, channelsFrom string) []channelJob {
+	dbKeywords := map[string][]string{}
+	for _, it := range keywordItems {
+		name := normalizeGroupName(it.Group)
+		dbKeywords[name] = append(dbKeywords[name], it.Value)
+	}
+
+	byGroup := map[string][]string{}
+	for _, it := range channels {
+		name := normalizeGroupName(it.Group)
+		if s.group(name) == nil {
+			s.log.Warn("unknown channel group, using default settings", slog.String("group", name))
+			s.addGroup(name)
+		}
+		byGroup[name] = append(byGroup[name], it.Value)
+	}
+
+	jobs := make([]channelJob, 0, len(channels))
+	seen := map[string]string{}
+
+	for _, g := range s.groups {
+		refs := byGroup[g.name]
+		if len(refs) == 0 {
+			continue
+		}
+
+		exprs, keywordsFrom := dbKeywords[g.name], "db"
+		if len(exprs) == 0 {
+			exprs, keywordsFrom = g.keywords, "config"
+		}
+		if len(exprs) == 0 {
+			exprs = s.groups[0].keywords
+		}
+
+		if err := g.setKeywords(exprs); err != nil {
+			s.log.Error("compile keywords failed, keeping previous set",
+				slog.String("group", g.name),
+				slog.String("source", keywordsFrom),
+				slog.Any("err", err),
+			)
+		}
+		if g.matcher == nil {
+			s.log.Error("group has no keywords, skipping its channels", slog.String("group", g.name))
+			continue
+		}
+
+		for _, ref := range refs {
+			src, _ := parseSource(ref)
+			if prev, ok := seen[src.index()]; ok && src.key() != "" {
+				s.log.Warn("channel listed in several groups, keeping first",
+					slog.String("channel", ref),
+					slog.String("group", g.name),
+					slog.String("kept_group", prev),
+				)
+				continue
+			}
+			seen[src.index()] = g.name
+			jobs = append(jobs, channelJob{ref: ref, src: src, group: g})
+		}
+
+		s.log.Info("group sources loaded",
+			slog.String("group", g.name),
+			slog.Int("channels", len(refs)),
+			slog.String("keywords_source", keywordsFrom),
+			slog.Int("keywords", g.matcher.Len()),
+		)
+	}
+
+	s.log.Info("sources loaded",
+		slog.String("channels_source", channelsFrom),
+		slog.Int("channels", len(jobs)),
+		slog.Int("groups", len(byGroup)),
+	)
+
+	return jobs
+}
+
+func (s *Scraper) configChannels() []storage.RegistryItem {
+	var out []storage.RegistryItem
+	for _, g := range s.groups {
+		for _, ref := range g.channels {
+			out = append(out, storage.RegistryItem{Value: ref, Group: g.name})
+		}
+	}
+	return out
+}
+
+func (s *Scraper) group(name string) *channelGroup {
+	for _, g := range s.groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// addGroup заводит группу, которая есть только в БД, с настройками группы по умолчанию
+func (s *Scraper) addGroup(name string) {
+	def := s.groups[0]
+	s.groups = append(s.groups, &channelGroup{
+		name:                 name,
+		mode:                 def.mode,
+		keywords:             def.keywords,
+		lookback:             def.lookback,
+		perChannelMaxScan:    def.perChannelMaxScan,
+		minDelay:             def.minDelay,
+		betweenChannelsDelay: def.betweenChannelsDelay,
+	})
+}
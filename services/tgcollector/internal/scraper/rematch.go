@@ -0,0 +1,91 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// RematchConfig это прогон текущих выражений по архиву messages
+type RematchConfig struct {
+	// Since: какие сообщения брать, по дате сообщения. Нулевой -> весь архив
+	Since time.Time
+	// Notify: отдавать новые hits в notifier. По умолчанию нет, как и в backfill
+	Notify bool
+	// BatchSize это сколько сообщений читать из архива за раз
+	BatchSize int
+}
+
+// RematchResult это итог rematch
+type RematchResult struct {
+	Scanned int
+	HitsNew int
+	// NoGroup это сообщения, чьей группы больше нет в конфиге и в БД
+	NoGroup int
+}
+
+// Rematch прогоняет архив messages через текущие выражения и сохраняет новые hits
+// Telegram не нужен: все, что надо для hit, лежит в архиве. Сообщение проверяется
+// выражениями группы, в которой канал был, когда сообщение попало в архив
+func (s *Scraper) Rematch(ctx context.Context, c RematchConfig) (RematchResult, error) {
+	var res RematchResult
+	if c.BatchSize <= 0 {
+		c.BatchSize = 500
+	}
+
+	// подтягиваем выражения из БД в группы
+	s.refreshSources(ctx)
+
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		msgs, err := s.store.ListArchivedMessages(ctx, c.Since, afterID, c.BatchSize)
+		if err != nil {
+			return res, fmt.Errorf("list archived messages: %w", err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+
+		for _, msg := range msgs {
+			afterID = msg.ID
+			res.Scanned++
+
+			s.mu.RLock()
+			g := s.group(normalizeGroupName(msg.Group))
+			s.mu.RUnlock()
+			if g == nil {
+				res.NoGroup++
+				continue
+			}
+
+			h, ok := matchMessage(g, msg)
+			if !ok {
+				continue
+			}
+			h.Silent = !c.Notify
+
+			r, err := s.store.SaveHit(ctx, h)
+			if err != nil {
+				return res, fmt.Errorf("save hit %s/%d: %w", msg.Channel, msg.MessageID, err)
+			}
+			if r == storage.SaveInserted {
+				res.HitsNew++
+			}
+		}
+
+		s.log.Info("rematch batch done",
+			slog.Int("scanned", res.Scanned),
+			slog.Int("hits_new", res.HitsNew),
+			slog.Int64("last_id", afterID),
+		)
+	}
+
+	return res, nil
+}
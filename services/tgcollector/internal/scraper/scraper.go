@@ -2,34 +2,78 @@ package scraper
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/tg"
-
+	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
 	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
 )
 
 type Config struct {
-	Channels []string
-	Keywords []string
-	Lookback time.Duration
+	Channels    []string
+	Keywords    []string
+	KeywordMode string
+	Lookback    time.Duration
 
 	PerChannelMaxScan    int
 	MinDelay             time.Duration
 	BetweenChannelsDelay time.Duration
+
+	// EditWindow: насколько назад от чекпоинта перечитывать историю ради правок, 0 выключает
+	EditWindow time.Duration
+
+	// DeletedCheckWindow: насколько свежие hits перепроверять на удаление, 0 выключает
+	DeletedCheckWindow   time.Duration
+	DeletedCheckInterval time.Duration
+
+	Media MediaConfig
+
+	// Archive: складывать в messages все просмотренные сообщения, не только hits
+	Archive bool
+
+	Health HealthConfig
+
+	// Concurrency это сколько каналов обходить параллельно, 1 -> по очереди
+	Concurrency int
+
+	Groups []GroupConfig
 }
 
 type Scraper struct {
 	cfg   Config
 	log   *slog.Logger
 	store storage.Store
+
+	// groups[0] это группа по умолчанию, jobs это текущая очередь обхода
+	// и то и другое обновляется в refreshSources
+	//
+	// mu нужен из-за потока обновлений: он читает группы из своей горутины,
+	// пока Crawl их перечитывает
+	mu       sync.RWMutex
+	groups   []*channelGroup
+	jobs     []channelJob
+	bySource map[string]channelJob
+
+	// channelIDs это каналы, уже найденные при обходе, по id из Telegram (для потока обновлений)
+	// peers это приватные каналы и каналы по приглашению, чтобы не искать их заново
+	channelIDs map[int64]knownChannel
+	peers      map[string]*channelPeer
+
+	deletedCheckedAt map[string]time.Time
+
+	// media == nil, если скачивание медиа выключено
+	// realtimeAcc это аккаунт потока обновлений, через него обработчики качают медиа
+	media       *mediaFetcher
+	realtimeAcc *mtclient.Account
 }
 
-func New(cfg Config, log *slog.Logger, store storage.Store) *Scraper {
+func New(cfg Config, log *slog.Logger, store storage.Store) (*Scraper, error) {
+	if store == nil {
+		return nil, errors.New("scraper: store is nil")
+	}
 	if log == nil {
 		log = slog.Default()
 	}
@@ -42,6 +86,28 @@ func New(cfg Config, log *slog.Logger, store storage.Store) *Scraper {
 	if cfg.BetweenChannelsDelay <= 0 {
 		cfg.BetweenChannelsDelay = 2 * time.Second
 	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Health.BackoffBase <= 0 {
+		cfg.Health.BackoffBase = 30 * time.Minute
+	}
+	if cfg.Health.BackoffMax < cfg.Health.BackoffBase {
+		cfg.Health.BackoffMax = 24 * time.Hour
+	}
+	if cfg.DeletedCheckInterval <= 0 {
+		cfg.DeletedCheckInterval = 30 * time.Minute
+	}
+
+	groups, err := buildGroups(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := newMediaFetcher(cfg.Media)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Scraper{
 		cfg: cfg,
@@ -49,38 +115,196 @@ func New(cfg Config, log *slog.Logger, store storage.Store) *Scraper {
 			slog.String("layer", "worker"),
 			slog.String("module", "collector.scraper"),
 		),
-		store: store,
-	}
+		store:      store,
+		groups:     groups,
+		bySource:   map[string]channelJob{},
+		channelIDs: map[int64]knownChannel{},
+		peers:      map[string]*channelPeer{},
+
+		deletedCheckedAt: map[string]time.Time{},
+		media:            media,
+	}, nil
 }
 
-func (s *Scraper) Crawl(ctx context.Context, td *telegram.Client) error {
-	keywords := normalizeKeywords(s.cfg.Keywords)
-	api := tg.NewClient(td)
+// Crawl обходит все каналы
+//
+// каналы раздаются Concurrency воркерам, при 1 обход идет строго по очереди как раньше.
+// Все запросы все равно проходят через общий rate limiter клиента.
+// Каждый канал обходится отдельно: ошибка одного канала пишется в channel_health
+// и не мешает остальным. Ошибку Crawl возвращает только при отмене ctx
+func (s *Scraper) Crawl(ctx context.Context, pool *mtclient.Pool) error {
+	jobs := s.refreshSources(ctx)
+	quarantined := s.loadQuarantined(ctx)
 
-	for i, ref := range s.cfg.Channels {
-		ref = strings.TrimSpace(ref)
-		if ref == "" {
-			continue
-		}
+	if s.media != nil {
+		s.media.resetBudget()
+	}
 
-		username := normalizeUsername(ref)
-		if username == "" {
-			return fmt.Errorf("scraper: channel must be @username or t.me link, got %q", ref)
-		}
+	workers := min(s.cfg.Concurrency, len(jobs))
+	if workers < 1 {
+		workers = 1
+	}
 
-		s.log.Info("scan channel start", slog.Int("i", i), slog.String("channel", "@"+username))
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		counts = map[crawlOutcome]int{}
+	)
+	queue := make(chan indexedJob)
 
-		if err := s.scanChannel(ctx, api, username, keywords); err != nil {
-			return err
+	for w := 0; w < workers; w++ {
+		log := s.log
+		if workers > 1 {
+			log = log.With(slog.Int("worker", w))
 		}
 
-		if i < len(s.cfg.Channels)-1 {
-			if err := sleepCtx(ctx, s.cfg.BetweenChannelsDelay); err != nil {
-				return err
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// пауза between_channels_delay между каналами одного воркера,
+			// перед первым каналом и после пропущенных не ждем
+			var delay time.Duration
+			for j := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				outcome := s.crawlJob(ctx, pool, log, j, quarantined, delay)
+				if outcome == outcomeOK || outcome == outcomeFailed {
+					delay = j.job.group.betweenChannelsDelay
+				}
+
+				mu.Lock()
+				counts[outcome]++
+				mu.Unlock()
 			}
+		}()
+	}
+
+feed:
+	for i, job := range jobs {
+		select {
+		case queue <- indexedJob{i: i, job: job}:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(queue)
+	wg.Wait()
 
-	s.log.Info("crawl finished")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.log.Info("crawl finished",
+		slog.Int("workers", workers),
+		slog.Int("ok", counts[outcomeOK]),
+		slog.Int("failed", counts[outcomeFailed]),
+		slog.Int("quarantined", counts[outcomeQuarantined]),
+	)
 	return nil
 }
+
+type indexedJob struct {
+	i   int
+	job channelJob
+}
+
+type crawlOutcome int
+
+const (
+	outcomeNone crawlOutcome = iota
+	outcomeOK
+	outcomeFailed
+	outcomeQuarantined
+)
+
+// crawlJob обходит один канал, перед этим выждав delay
+func (s *Scraper) crawlJob(ctx context.Context, pool *mtclient.Pool, log *slog.Logger, j indexedJob, quarantined map[string]time.Time, delay time.Duration) crawlOutcome {
+	job := j.job
+
+	ref := strings.TrimSpace(job.ref)
+	if ref == "" {
+		return outcomeNone
+	}
+
+	if job.src.key() == "" {
+		log.Error("invalid channel ref, must be @username, t.me link, invite link or channel id",
+			slog.String("ref", ref),
+			slog.String("group", job.group.name),
+		)
+		return outcomeFailed
+	}
+	channel := job.src.name()
+
+	if until, ok := quarantined[channel]; ok {
+		log.Info("scan channel skipped: quarantined",
+			slog.String("channel", channel),
+			slog.Time("until", until),
+		)
+		return outcomeQuarantined
+	}
+
+	if err := sleepCtx(ctx, delay); err != nil {
+		return outcomeNone
+	}
+
+	log.Info("scan channel start",
+		slog.Int("i", j.i),
+		slog.String("channel", channel),
+		slog.String("group", job.group.name),
+	)
+
+	var stopReason string
+	err := s.onAccount(ctx, pool, job.src, func(acc *mtclient.Account) error {
+		var err error
+		stopReason, err = s.scanChannel(ctx, acc, job.src, job.group)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return outcomeNone
+		}
+		if errors.Is(err, mtclient.ErrNoAccounts) {
+			// канал тут ни при чем, в channel_health не пишем
+			log.Error("scan channel skipped: no mtproto account available",
+				slog.String("channel", channel),
+			)
+			return outcomeNone
+		}
+		log.Error("scan channel failed",
+			slog.Int("i", j.i),
+			slog.String("channel", channel),
+			slog.String("group", job.group.name),
+			slog.Any("err", err),
+		)
+		s.recordFailure(ctx, channel, err)
+		return outcomeFailed
+	}
+
+	s.recordSuccess(ctx, channel, stopReason)
+	return outcomeOK
+}
+
+// onAccount выполняет fn через аккаунт пула, закрепленный за источником
+// если аккаунт упал в долгий FLOOD_WAIT или потерял авторизацию, fn повторяется
+// на следующем подходящем аккаунте, пока они не кончатся
+func (s *Scraper) onAccount(ctx context.Context, pool *mtclient.Pool, src source, fn func(acc *mtclient.Account) error) error {
+	for {
+		acc, err := pool.Pick(src.key())
+		if err != nil {
+			return err
+		}
+
+		err = fn(acc)
+		if err == nil || ctx.Err() != nil || !pool.Failover(acc, err) {
+			return err
+		}
+
+		s.log.Warn("account failed, retrying channel on another account",
+			slog.String("channel", src.name()),
+			slog.String("account", acc.Name),
+			slog.Any("err", err),
+		)
+	}
+}
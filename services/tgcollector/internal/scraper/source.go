@@ -0,0 +1,380 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	mtclient "github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/mtproto"
+	"github.com/faringet/telegram-bot-scraper/services/tgcollector/internal/storage"
+)
+
+// source это разобранная ссылка на канал из channels / конфига, задано ровно одно из полей:
+//
+//	@name, t.me/name            -> username (публичный канал или супергруппа)
+//	-1001234567890, t.me/c/123  -> channelID (аккаунт сессии должен в нем состоять)
+//	t.me/+hash, t.me/joinchat/h -> invite (аккаунт вступает по ссылке при первом обходе)
+type source struct {
+	username  string
+	channelID int64
+	invite    string
+}
+
+func parseSource(ref string) (source, bool) {
+	s := strings.TrimSpace(ref)
+	if s == "" {
+		return source{}, false
+	}
+
+	if id, ok := parseChannelID(s); ok {
+		return source{channelID: id}, true
+	}
+	if strings.HasPrefix(s, "@") {
+		return source{username: strings.TrimPrefix(s, "@")}, true
+	}
+
+	s = strings.TrimPrefix(s, "https://")
+	s = strings.TrimPrefix(s, "http://")
+	path, ok := strings.CutPrefix(s, "t.me/")
+	if !ok {
+		path, ok = strings.CutPrefix(s, "telegram.me/")
+	}
+	if !ok || path == "" {
+		return source{}, false
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	switch {
+	case strings.HasPrefix(path, "+"):
+		return source{invite: strings.TrimPrefix(path, "+")}, len(path) > 1
+	case strings.HasPrefix(path, "joinchat/"):
+		hash := strings.TrimPrefix(path, "joinchat/")
+		return source{invite: hash}, hash != ""
+	case strings.HasPrefix(path, "c/"):
+		// t.me/c/<id> или ссылка на сообщение t.me/c/<id>/<msg>
+		idPart, _, _ := strings.Cut(strings.TrimPrefix(path, "c/"), "/")
+		id, err := strconv.ParseInt(idPart, 10, 64)
+		if err != nil || id <= 0 {
+			return source{}, false
+		}
+		return source{channelID: id}, true
+	}
+
+	return source{username: path}, true
+}
+
+// parseChannelID понимает id как в Bot API (-100...) и голое положительное число
+func parseChannelID(s string) (int64, bool) {
+	if strings.HasPrefix(s, "-100") {
+		s = strings.TrimPrefix(s, "-100")
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// key это имя источника в checkpoints и checkpoint_gaps
+// для публичных каналов это username без @, как было всегда
+func (src source) key() string {
+	switch {
+	case src.channelID > 0:
+		return privateChannelName(src.channelID)
+	case src.invite != "":
+		return "+" + src.invite
+	default:
+		return src.username
+	}
+}
+
+// name это имя источника в логах и channel_health
+func (src source) name() string {
+	if src.username != "" {
+		return "@" + src.username
+	}
+	return src.key()
+}
+
+// index это ключ в Scraper.bySource: username без учета регистра, остальное как есть
+func (src source) index() string {
+	if src.username != "" {
+		return strings.ToLower(src.username)
+	}
+	return src.key()
+}
+
+func privateChannelName(id int64) string {
+	return "c/" + strconv.FormatInt(id, 10)
+}
+
+// channelPeer это источник после resolve
+// name идет в hits.channel, linkBase это начало ссылки на сообщение
+type channelPeer struct {
+	peer     *tg.InputPeerChannel
+	name     string
+	linkBase string
+}
+
+func (c *channelPeer) link(msgID int) string {
+	return fmt.Sprintf("%s/%d", c.linkBase, msgID)
+}
+
+// publicPeer оставляет имя канала таким, как оно записано в источнике,
+// чтобы hits.channel не менялся от регистра username в Telegram
+func publicPeer(p *tg.InputPeerChannel, username string) *channelPeer {
+	return &channelPeer{peer: p, name: "@" + username, linkBase: "https://t.me/" + username}
+}
+
+// peerFor собирает channelPeer из найденного канала
+// у источника по username имя берем из источника, у остальных публичный username канала,
+// если он есть, иначе ссылки идут через t.me/c/<id>
+func peerFor(src source, r storage.ResolvedPeer) *channelPeer {
+	p := &tg.InputPeerChannel{ChannelID: r.ChannelID, AccessHash: r.AccessHash}
+	switch {
+	case src.username != "":
+		return publicPeer(p, src.username)
+	case r.Username != "":
+		return publicPeer(p, r.Username)
+	}
+	return &channelPeer{
+		peer:     p,
+		name:     privateChannelName(r.ChannelID),
+		linkBase: "https://t.me/" + privateChannelName(r.ChannelID),
+	}
+}
+
+func peerFromChannel(ch *tg.Channel) *channelPeer {
+	return peerFor(source{}, resolvedFromChannel(ch))
+}
+
+func resolvedFromChannel(ch *tg.Channel) storage.ResolvedPeer {
+	return storage.ResolvedPeer{
+		ChannelID:  ch.ID,
+		AccessHash: ch.AccessHash,
+		Title:      ch.Title,
+		Username:   channelUsername(ch),
+	}
+}
+
+func channelUsername(ch *tg.Channel) string {
+	if ch.Username != "" {
+		return ch.Username
+	}
+	for _, un := range ch.Usernames {
+		if un.Active {
+			return un.Username
+		}
+	}
+	return ""
+}
+
+// resolveSource находит канал источника
+//
+// найденный канал лежит в памяти (s.peers) и в resolved_peers, так что
+// contacts.resolveUsername, перебор диалогов и приглашения дергаются только
+// для новых источников и после forgetPeer, когда Telegram отверг сохраненный access_hash
+func (s *Scraper) resolveSource(ctx context.Context, acc *mtclient.Account, src source) (*channelPeer, error) {
+	key := src.key()
+	cacheKey := peerCacheKey(acc, src)
+
+	s.mu.RLock()
+	cached, ok := s.peers[cacheKey]
+	s.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	r, ok, err := s.store.GetResolvedPeer(ctx, acc.Name, key)
+	if err != nil {
+		s.log.Warn("load resolved peer failed, resolving again",
+			slog.String("channel", src.name()),
+			slog.Any("err", err),
+		)
+	}
+
+	fresh := !ok
+	if fresh {
+		api, err := accountAPI(acc)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := resolveChannel(ctx, api, src)
+		if err != nil {
+			return nil, err
+		}
+		r = resolvedFromChannel(ch)
+
+		if err := s.store.SaveResolvedPeer(ctx, acc.Name, key, r); err != nil {
+			s.log.Warn("save resolved peer failed",
+				slog.String("channel", src.name()),
+				slog.Any("err", err),
+			)
+		}
+	}
+
+	p := peerFor(src, r)
+
+	s.mu.Lock()
+	s.peers[cacheKey] = p
+	s.mu.Unlock()
+
+	if fresh {
+		s.adoptChannelHits(ctx, p)
+	}
+	return p, nil
+}
+
+// adoptChannelHits после нового resolve переносит прошлые hits канала на текущее имя,
+// чтобы переименование канала или ссылки в источнике не разрывало историю
+func (s *Scraper) adoptChannelHits(ctx context.Context, p *channelPeer) {
+	n, err := s.store.AdoptChannelHits(ctx, p.peer.ChannelID, p.name, p.linkBase)
+	if err != nil {
+		s.log.Warn("adopt channel hits failed",
+			slog.String("channel", p.name),
+			slog.Any("err", err),
+		)
+		return
+	}
+	if n > 0 {
+		s.log.Info("channel hits adopted",
+			slog.String("channel", p.name),
+			slog.Int64("channel_id", p.peer.ChannelID),
+			slog.Int("hits", n),
+		)
+	}
+}
+
+// peerCacheKey это ключ в s.peers: один и тот же канал у разных аккаунтов имеет разный access_hash
+func peerCacheKey(acc *mtclient.Account, src source) string {
+	return acc.Name + " " + src.key()
+}
+
+// accountAPI отдает клиента аккаунта или ошибку, если аккаунт успел остановиться
+func accountAPI(acc *mtclient.Account) (*tg.Client, error) {
+	api := acc.API()
+	if api == nil {
+		return nil, fmt.Errorf("account %s is not running", acc.Name)
+	}
+	return api, nil
+}
+
+// forgetPeer выкидывает сохраненный канал аккаунта, следующий resolveSource найдет его заново
+func (s *Scraper) forgetPeer(ctx context.Context, acc *mtclient.Account, src source) {
+	s.mu.Lock()
+	delete(s.peers, peerCacheKey(acc, src))
+	s.mu.Unlock()
+
+	if err := s.store.DeleteResolvedPeer(ctx, acc.Name, src.key()); err != nil {
+		s.log.Warn("delete resolved peer failed",
+			slog.String("channel", src.name()),
+			slog.Any("err", err),
+		)
+	}
+}
+
+// isPeerRejected говорит, что Telegram не принял сохраненный канал:
+// access_hash устарел, канал стал приватным или аккаунт из него вышел
+func isPeerRejected(err error) bool {
+	return tgerr.Is(err, tg.ErrChannelInvalid, tg.ErrChannelPrivate, tg.ErrPeerIDInvalid)
+}
+
+func resolveChannel(ctx context.Context, api *tg.Client, src source) (*tg.Channel, error) {
+	switch {
+	case src.username != "":
+		return resolveUsername(ctx, api, src.username)
+	case src.invite != "":
+		return joinInvite(ctx, api, src.invite)
+	default:
+		return findDialogChannel(ctx, api, src.channelID)
+	}
+}
+
+// resolveUsername принимает и каналы, и супергруппы: для MTProto это один и тот же tg.Channel
+func resolveUsername(ctx context.Context, api *tg.Client, username string) (*tg.Channel, error) {
+	r, err := api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: username})
+	if err != nil {
+		return nil, fmt.Errorf("resolve @%s: %w", username, err)
+	}
+
+	ch, err := channelFromChats(r.Chats)
+	if err != nil {
+		return nil, fmt.Errorf("resolve @%s: %w", username, err)
+	}
+	return ch, nil
+}
+
+// joinInvite вступает в канал по приглашению, если аккаунт сессии еще не в нем
+func joinInvite(ctx context.Context, api *tg.Client, hash string) (*tg.Channel, error) {
+	invite, err := api.MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("check invite +%s: %w", hash, err)
+	}
+
+	if already, ok := invite.(*tg.ChatInviteAlready); ok {
+		ch, err := channelFromChats([]tg.ChatClass{already.Chat})
+		if err != nil {
+			return nil, fmt.Errorf("check invite +%s: %w", hash, err)
+		}
+		return ch, nil
+	}
+
+	upd, err := api.MessagesImportChatInvite(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("join invite +%s: %w", hash, err)
+	}
+
+	var chats []tg.ChatClass
+	switch u := upd.(type) {
+	case *tg.Updates:
+		chats = u.Chats
+	case *tg.UpdatesCombined:
+		chats = u.Chats
+	}
+
+	ch, err := channelFromChats(chats)
+	if err != nil {
+		return nil, fmt.Errorf("join invite +%s: %w", hash, err)
+	}
+	return ch, nil
+}
+
+// findDialogChannel ищет канал по id среди диалогов аккаунта сессии:
+// access_hash приватного канала можно получить только так
+func findDialogChannel(ctx context.Context, api *tg.Client, id int64) (*tg.Channel, error) {
+	it := query.GetDialogs(api).BatchSize(100).Iter()
+	for it.Next(ctx) {
+		if ch, ok := it.Value().Entities.Channel(id); ok {
+			return ch, nil
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("resolve %s: dialogs: %w", privateChannelName(id), err)
+	}
+	return nil, fmt.Errorf("resolve %s: channel not found in dialogs of the session account", privateChannelName(id))
+}
+
+var errBasicGroup = errors.New("basic groups are not supported, convert the group to a supergroup")
+
+func channelFromChats(chats []tg.ChatClass) (*tg.Channel, error) {
+	basic := false
+	for _, cc := range chats {
+		switch c := cc.(type) {
+		case *tg.Channel:
+			return c, nil
+		case *tg.Chat:
+			basic = true
+		}
+	}
+	if basic {
+		return nil, errBasicGroup
+	}
+	return nil, errors.New("channel not found")
+}
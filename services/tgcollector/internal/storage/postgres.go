@@ -3,25 +3,27 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/faringet/telegram-bot-scraper/internal/platform/searchtext"
 )
 
 type Postgres struct {
-	db          *sql.DB
-	dedupWindow time.Duration
+	db      *sql.DB
+	stories StoryConfig
 }
 
-func NewPostgres(db *sql.DB, dedupWindow time.Duration) (*Postgres, error) {
+func NewPostgres(db *sql.DB, stories StoryConfig) (*Postgres, error) {
 	if db == nil {
 		return nil, errors.New("collector postgres storage: db is nil")
 	}
 	return &Postgres{
-		db:          db,
-		dedupWindow: dedupWindow,
+		db:      db,
+		stories: stories,
 	}, nil
 }
 
@@ -32,44 +34,621 @@ func (s *Postgres) Close() error {
 	return s.db.Close()
 }
 
-func (s *Postgres) SaveHit(ctx context.Context, h Hit) (bool, error) {
+func (s *Postgres) SaveHit(ctx context.Context, h Hit) (SaveResult, error) {
 	if s == nil || s.db == nil {
-		return false, errors.New("collector postgres storage: db is nil")
+		return SaveSkipped, errors.New("collector postgres storage: db is nil")
 	}
 	if h.Channel == "" || h.MessageID <= 0 || h.Text == "" || h.Link == "" || h.Keyword == "" {
-		return false, errors.New("collector postgres storage: invalid hit (channel/message_id/text/link/keyword required)")
+		return SaveSkipped, errors.New("collector postgres storage: invalid hit (channel/message_id/text/link/keyword required)")
 	}
 	if h.MessageDate.IsZero() {
-		return false, errors.New("collector postgres storage: message_date is required")
+		return SaveSkipped, errors.New("collector postgres storage: message_date is required")
+	}
+	if h.Group == "" {
+		h.Group = "default"
 	}
 
-	searchText, searchTextNormalized := searchtext.Build(h.Channel, h.Keyword, h.Text)
+	// keyword в поиск не кладем: это целое выражение вместе с NOT и операторами,
+	// и hit с правилом "... NOT вакансия" находился бы по слову "вакансия"
+	searchText, searchTextNormalized := searchtext.Build(h.Channel, h.Text)
 	if searchText == "" || searchTextNormalized == "" {
-		return false, errors.New("collector postgres storage: search text is empty")
+		return SaveSkipped, errors.New("collector postgres storage: search text is empty")
 	}
 
-	res, err := s.db.ExecContext(ctx, `
+	meta, err := json.Marshal(h.Meta)
+	if err != nil {
+		return SaveSkipped, fmt.Errorf("collector postgres save hit: marshal meta: %w", err)
+	}
+
+	simhash := s.simhash(h.Text)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SaveSkipped, fmt.Errorf("collector postgres save hit: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var hitID int64
+	err = tx.QueryRowContext(ctx, `
 INSERT INTO hits (
 	channel,
+	channel_id,
 	message_id,
 	message_date,
 	text,
+	text_html,
 	link,
 	keyword,
 	search_text,
 	search_text_normalized,
+	channel_group,
+	edit_date,
+	media_type,
+	fwd_from,
+	views,
+	forwards,
+	reactions,
+	meta,
+	simhash,
 	created_at,
 	delivered_at
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NULL)
-ON CONFLICT (channel, message_id) DO NOTHING
-`, h.Channel, h.MessageID, h.MessageDate.UTC(), h.Text, h.Link, h.Keyword, searchText, searchTextNormalized)
+VALUES ($1, NULLIF($18, 0), $2, $3, $4, NULLIF($20, ''), $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, ''), $13, $14, $15, $16, $19, NOW(), CASE WHEN $17 THEN NOW() END)
+ON CONFLICT DO NOTHING
+RETURNING id
+`,
+		h.Channel, h.MessageID, h.MessageDate.UTC(), h.Text, h.Link, h.Keyword, searchText, searchTextNormalized, h.Group, nullTime(h.EditDate),
+		h.Meta.MediaType, h.Meta.FwdFrom, nullInt(h.Stats.Views), nullInt(h.Stats.Forwards), nullInt(h.Stats.Reactions), string(meta),
+		h.Silent, h.ChannelID, simhash, h.TextHTML,
+	).Scan(&hitID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return SaveSkipped, fmt.Errorf("collector postgres save hit: %w", err)
+		}
+
+		if err := refreshHitStats(ctx, tx, h); err != nil {
+			return SaveSkipped, err
+		}
+
+		result := SaveSkipped
+		if !h.EditDate.IsZero() {
+			updated, err := s.updateEditedHit(ctx, tx, h, searchText, searchTextNormalized, string(meta), simhash)
+			if err != nil {
+				return SaveSkipped, err
+			}
+			if updated {
+				result = SaveUpdated
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return SaveSkipped, fmt.Errorf("collector postgres save existing hit: commit: %w", err)
+		}
+		return result, nil
+	}
+
+	if err := insertHitKeywords(ctx, tx, hitID, h); err != nil {
+		return SaveSkipped, err
+	}
+	if err := insertHitEntities(ctx, tx, hitID, h.Entities); err != nil {
+		return SaveSkipped, err
+	}
+
+	if err := s.assignStory(ctx, tx, hitID, h, simhash); err != nil {
+		return SaveSkipped, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return SaveSkipped, fmt.Errorf("collector postgres save hit: commit: %w", err)
+	}
+
+	return SaveInserted, nil
+}
+
+// simhash это отпечаток текста hit для склейки историй, NULL если текст слишком короткий
+func (s *Postgres) simhash(text string) sql.NullInt64 {
+	fp, ok := searchtext.SimHash(text, s.stories.MinWords)
+	if !ok {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(fp), Valid: true}
+}
+
+// assignStory кладет новый hit в историю ближайшего похожего hit из другого канала,
+// а если такого нет, hit открывает свою историю (story_id = id)
+//
+// похожий значит SimHash отличается не больше чем на stories.max_distance бит,
+// а сообщение вышло не дальше stories.window от нашего. Свой канал не смотрим:
+// у каналов с шаблонными постами (сводки, курсы) все посты были бы одной историей
+func (s *Postgres) assignStory(ctx context.Context, tx *sql.Tx, hitID int64, h Hit, simhash sql.NullInt64) error {
+	if s.stories.Window <= 0 || !simhash.Valid {
+		if _, err := tx.ExecContext(ctx, `UPDATE hits SET story_id = id WHERE id = $1`, hitID); err != nil {
+			return fmt.Errorf("collector postgres assign story: %w", err)
+		}
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+UPDATE hits
+SET story_id = COALESCE((
+	SELECT c.story_id
+	FROM hits c
+	WHERE c.simhash IS NOT NULL
+	  AND c.story_id IS NOT NULL
+	  AND c.id <> $1
+	  AND c.channel <> $2
+	  AND c.message_date BETWEEN $3::timestamptz - make_interval(secs => $5) AND $3::timestamptz + make_interval(secs => $5)
+	  AND bit_count((c.simhash # $4)::bit(64)) <= $6
+	ORDER BY bit_count((c.simhash # $4)::bit(64)), c.id
+	LIMIT 1
+), id)
+WHERE id = $1
+`, hitID, h.Channel, h.MessageDate.UTC(), simhash.Int64, s.stories.Window.Seconds(), s.stories.MaxDistance)
+	if err != nil {
+		return fmt.Errorf("collector postgres assign story: %w", err)
+	}
+	return nil
+}
+
+// moveStory достает hit из его истории и заново ищет ему историю по новому simhash
+//
+// если hit был в истории первым, первым становится следующий по id:
+// иначе копии остались бы в истории без первого hit, и classifier их бы не классифицировал
+func (s *Postgres) moveStory(ctx context.Context, tx *sql.Tx, hitID int64, h Hit, simhash sql.NullInt64) error {
+	if _, err := tx.ExecContext(ctx, `
+UPDATE hits
+SET story_id = (
+	SELECT MIN(o.id)
+	FROM hits o
+	WHERE o.story_id = $1
+	  AND o.id <> $1
+)
+WHERE story_id = $1
+  AND id <> $1
+`, hitID); err != nil {
+		return fmt.Errorf("collector postgres move story: %w", err)
+	}
+
+	return s.assignStory(ctx, tx, hitID, h, simhash)
+}
+
+// updateEditedHit применяет правку к уже сохраненному hit
+//
+// прошлый текст уходит в hit_versions, ключевые слова и разметка пересчитываются.
+// Если текст поменялся по существу (а не только пробелы/пунктуация/регистр),
+// сбрасываем классификацию, и classifier возьмет hit заново.
+// delivered_at не трогаем: повторно в канал уведомлений правки не шлем.
+// Если поменялся simhash, hit может оказаться уже другой историей, так что историю ищем заново
+func (s *Postgres) updateEditedHit(ctx context.Context, tx *sql.Tx, h Hit, searchText, searchTextNormalized, meta string, simhash sql.NullInt64) (bool, error) {
+	var (
+		hitID      int64
+		oldText    string
+		oldKW      string
+		oldEdit    sql.NullTime
+		oldSimhash sql.NullInt64
+		version    int
+	)
+	err := tx.QueryRowContext(ctx, `
+SELECT id, text, keyword, edit_date, simhash, version
+FROM hits
+WHERE channel = $1
+  AND message_id = $2
+FOR UPDATE
+`, h.Channel, h.MessageID).Scan(&hitID, &oldText, &oldKW, &oldEdit, &oldSimhash, &version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// hit успели удалить между INSERT и SELECT
+			return false, nil
+		}
+		return false, fmt.Errorf("collector postgres load hit for edit: %w", err)
+	}
+
+	if oldEdit.Valid && !h.EditDate.After(oldEdit.Time) {
+		return false, nil
+	}
+
+	if oldText == h.Text {
+		// правка не текста (например медиа или кнопок), запоминаем дату и метаданные
+		if _, err := tx.ExecContext(ctx, `
+UPDATE hits
+SET edit_date = $1,
+    edited_at = NOW(),
+    media_type = NULLIF($2, ''),
+    meta = $3,
+    text_html = NULLIF($5, '')
+WHERE id = $4
+`, h.EditDate.UTC(), h.Meta.MediaType, meta, hitID, h.TextHTML); err != nil {
+			return false, fmt.Errorf("collector postgres update hit edit date: %w", err)
+		}
+		// ссылку или жирный можно поправить, не меняя текста
+		if err := replaceHitEntities(ctx, tx, hitID, h.Entities); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO hit_versions (hit_id, version, text, keyword, edit_date, created_at)
+VALUES ($1, $2, $3, $4, $5, NOW())
+ON CONFLICT (hit_id, version) DO NOTHING
+`, hitID, version, oldText, oldKW, oldEdit); err != nil {
+		return false, fmt.Errorf("collector postgres save hit version: %w", err)
+	}
+
+	material := searchtext.Normalize(oldText) != searchtext.Normalize(h.Text)
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE hits
+SET text = $1,
+    text_html = NULLIF($11, ''),
+    keyword = $2,
+    search_text = $3,
+    search_text_normalized = $4,
+    edit_date = $5,
+    edited_at = NOW(),
+    version = version + 1,
+    media_type = NULLIF($8, ''),
+    meta = $9,
+    simhash = $10,
+    category = CASE WHEN $6 THEN NULL ELSE category END,
+    classified_at = CASE WHEN $6 THEN NULL ELSE classified_at END,
+    llm_model = CASE WHEN $6 THEN NULL ELSE llm_model END,
+    llm_confidence = CASE WHEN $6 THEN NULL ELSE llm_confidence END,
+    llm_reason = CASE WHEN $6 THEN NULL ELSE llm_reason END
+WHERE id = $7
+`, h.Text, h.Keyword, searchText, searchTextNormalized, h.EditDate.UTC(), material, hitID, h.Meta.MediaType, meta, simhash, h.TextHTML); err != nil {
+		return false, fmt.Errorf("collector postgres update edited hit: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM hit_keywords WHERE hit_id = $1`, hitID); err != nil {
+		return false, fmt.Errorf("collector postgres reset hit keywords: %w", err)
+	}
+	if err := insertHitKeywords(ctx, tx, hitID, h); err != nil {
+		return false, err
+	}
+	if err := replaceHitEntities(ctx, tx, hitID, h.Entities); err != nil {
+		return false, err
+	}
+
+	if oldSimhash != simhash {
+		if err := s.moveStory(ctx, tx, hitID, h, simhash); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// refreshHitStats обновляет счетчики уже сохраненного hit, уменьшать их не даем
+func refreshHitStats(ctx context.Context, tx *sql.Tx, h Hit) error {
+	if h.Stats.Views == nil && h.Stats.Forwards == nil && h.Stats.Reactions == nil {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+UPDATE hits
+SET views = GREATEST(views, $3),
+    forwards = GREATEST(forwards, $4),
+    reactions = GREATEST(reactions, $5)
+WHERE channel = $1
+  AND message_id = $2
+`, h.Channel, h.MessageID, nullInt(h.Stats.Views), nullInt(h.Stats.Forwards), nullInt(h.Stats.Reactions))
+	if err != nil {
+		return fmt.Errorf("collector postgres refresh hit stats: %w", err)
+	}
+	return nil
+}
+
+func nullInt(v *int) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*v), Valid: true}
+}
+
+func intPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func insertHitKeywords(ctx context.Context, tx *sql.Tx, hitID int64, h Hit) error {
+	keywords := h.Keywords
+	if len(keywords) == 0 {
+		keywords = []HitKeyword{{Keyword: h.Keyword}}
+	}
+
+	for _, kw := range keywords {
+		if kw.Keyword == "" {
+			continue
+		}
+
+		if len(kw.Spans) == 0 {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO hit_keywords (hit_id, keyword, start_offset, end_offset)
+VALUES ($1, $2, NULL, NULL)
+`, hitID, kw.Keyword); err != nil {
+				return fmt.Errorf("collector postgres save hit keyword: %w", err)
+			}
+			continue
+		}
+
+		for _, sp := range kw.Spans {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO hit_keywords (hit_id, keyword, start_offset, end_offset)
+VALUES ($1, $2, $3, $4)
+`, hitID, kw.Keyword, sp.Start, sp.End); err != nil {
+				return fmt.Errorf("collector postgres save hit keyword: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func insertHitEntities(ctx context.Context, tx *sql.Tx, hitID int64, entities []HitEntity) error {
+	for _, e := range entities {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO hit_entities (hit_id, type, start_offset, end_offset, value, domain)
+VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+`, hitID, e.Type, e.Start, e.End, e.Value, e.Domain); err != nil {
+			return fmt.Errorf("collector postgres save hit entity: %w", err)
+		}
+	}
+	return nil
+}
+
+func replaceHitEntities(ctx context.Context, tx *sql.Tx, hitID int64, entities []HitEntity) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM hit_entities WHERE hit_id = $1`, hitID); err != nil {
+		return fmt.Errorf("collector postgres reset hit entities: %w", err)
+	}
+	return insertHitEntities(ctx, tx, hitID, entities)
+}
+
+// SaveHitMedia кладет файл на место через place и записывает его в hit_media,
+// держа блокировку пути: между проверкой retention, что путь никому не нужен,
+// и удалением файла запись для нового hit вклиниться не может
+func (s *Postgres) SaveHitMedia(ctx context.Context, channel string, messageID int64, m HitMedia, place func() error) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if channel == "" || messageID <= 0 || m.Path == "" || m.SHA256 == "" {
+		return errors.New("collector postgres storage: invalid hit media (channel/message_id/path/sha256 required)")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("collector postgres save hit media: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := lockMediaPath(ctx, tx, m.Path); err != nil {
+		return err
+	}
+	if place != nil {
+		if err := place(); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO hit_media (hit_id, kind, mime_type, file_name, size_bytes, sha256, path, created_at)
+SELECT h.id, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, NOW()
+FROM hits h
+WHERE h.channel = $1
+  AND h.message_id = $2
+ON CONFLICT (hit_id, sha256) DO NOTHING
+`, channel, messageID, m.Kind, m.MimeType, m.FileName, m.SizeBytes, m.SHA256, m.Path)
 	if err != nil {
-		return false, fmt.Errorf("collector postgres save hit: %w", err)
+		return fmt.Errorf("collector postgres save hit media: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("collector postgres save hit media: commit: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) ListAliveMessageIDs(ctx context.Context, channel string, since time.Time) ([]int64, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("collector postgres storage: db is nil")
+	}
+	if channel == "" {
+		return nil, errors.New("collector postgres storage: channel is required")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT message_id
+FROM hits
+WHERE channel = $1
+  AND message_date >= $2
+  AND deleted_at IS NULL
+ORDER BY message_id DESC
+`, channel, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("collector postgres list alive message ids: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]int64, 0, 64)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("collector postgres scan message id: %w", err)
+		}
+		out = append(out, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("collector postgres rows: %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *Postgres) MarkDeleted(ctx context.Context, channel string, messageIDs []int64) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("collector postgres storage: db is nil")
+	}
+	if channel == "" {
+		return 0, errors.New("collector postgres storage: channel is required")
+	}
+	if len(messageIDs) == 0 {
+		return 0, nil
+	}
+
+	args := make([]any, 0, len(messageIDs)+1)
+	args = append(args, channel)
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+UPDATE hits
+SET deleted_at = NOW()
+WHERE channel = $1
+  AND deleted_at IS NULL
+  AND message_id IN (`+pgPlaceholders(2, len(messageIDs))+`)
+`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("collector postgres mark deleted: %w", err)
 	}
 
 	affected, _ := res.RowsAffected()
-	return affected > 0, nil
+	return int(affected), nil
+}
+
+func pgPlaceholders(start, n int) string {
+	parts := make([]string, n)
+	for i := 0; i < n; i++ {
+		parts[i] = fmt.Sprintf("$%d", start+i)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *Postgres) ListQuarantined(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("collector postgres storage: db is nil")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT channel, quarantined_until
+FROM channel_health
+WHERE quarantined_until > $1
+`, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("collector postgres list quarantined: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			channel string
+			until   time.Time
+		)
+		if err := rows.Scan(&channel, &until); err != nil {
+			return nil, fmt.Errorf("collector postgres scan quarantined: %w", err)
+		}
+		out[channel] = until.UTC()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("collector postgres rows: %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *Postgres) RecordChannelSuccess(ctx context.Context, channel, stopReason string) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if channel == "" {
+		return errors.New("collector postgres storage: channel is required")
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO channel_health (channel, last_attempt_at, last_success_at, consecutive_failures, stop_reason, updated_at)
+VALUES ($1, NOW(), NOW(), 0, $2, NOW())
+ON CONFLICT (channel)
+DO UPDATE SET
+	last_attempt_at = EXCLUDED.last_attempt_at,
+	last_success_at = EXCLUDED.last_success_at,
+	consecutive_failures = 0,
+	stop_reason = EXCLUDED.stop_reason,
+	quarantined_until = NULL,
+	alerted_at = NULL,
+	updated_at = EXCLUDED.updated_at
+`, channel, stopReason)
+	if err != nil {
+		return fmt.Errorf("collector postgres record channel success: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) RecordChannelFailure(ctx context.Context, channel, lastError string) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("collector postgres storage: db is nil")
+	}
+	if channel == "" {
+		return 0, errors.New("collector postgres storage: channel is required")
+	}
+
+	var failures int
+	err := s.db.QueryRowContext(ctx, `
+INSERT INTO channel_health (channel, last_attempt_at, consecutive_failures, last_error, stop_reason, updated_at)
+VALUES ($1, NOW(), 1, $2, 'error', NOW())
+ON CONFLICT (channel)
+DO UPDATE SET
+	last_attempt_at = EXCLUDED.last_attempt_at,
+	consecutive_failures = channel_health.consecutive_failures + 1,
+	last_error = EXCLUDED.last_error,
+	stop_reason = EXCLUDED.stop_reason,
+	updated_at = EXCLUDED.updated_at
+RETURNING consecutive_failures
+`, channel, lastError).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("collector postgres record channel failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (s *Postgres) QuarantineChannel(ctx context.Context, channel string, until time.Time) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if channel == "" {
+		return errors.New("collector postgres storage: channel is required")
+	}
+
+	// новый карантин (прошлый истек) -> сбрасываем alerted_at, чтобы notifier оповестил снова,
+	// продление еще идущего карантина повторного оповещения не дает
+	_, err := s.db.ExecContext(ctx, `
+UPDATE channel_health
+SET alerted_at = CASE
+        WHEN quarantined_until IS NULL OR quarantined_until <= NOW() THEN NULL
+        ELSE alerted_at
+    END,
+    quarantined_until = $2,
+    updated_at = NOW()
+WHERE channel = $1
+`, channel, until.UTC())
+	if err != nil {
+		return fmt.Errorf("collector postgres quarantine channel: %w", err)
+	}
+
+	return nil
 }
 
 func (s *Postgres) GetCheckpoint(ctx context.Context, channelUsername string) (int64, error) {
@@ -122,22 +701,767 @@ DO UPDATE SET
 	return nil
 }
 
-func (s *Postgres) Prune(ctx context.Context) error {
+func (s *Postgres) ListScanGaps(ctx context.Context, channelUsername string) ([]ScanGap, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("collector postgres storage: db is nil")
+	}
+	if channelUsername == "" {
+		return nil, errors.New("collector postgres storage: channelUsername is required")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, from_message_id, to_message_id
+FROM checkpoint_gaps
+WHERE channel_username = $1
+ORDER BY to_message_id DESC
+`, channelUsername)
+	if err != nil {
+		return nil, fmt.Errorf("collector postgres list scan gaps: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ScanGap
+	for rows.Next() {
+		var g ScanGap
+		if err := rows.Scan(&g.ID, &g.FromID, &g.ToID); err != nil {
+			return nil, fmt.Errorf("collector postgres scan gap: %w", err)
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("collector postgres rows: %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *Postgres) AddScanGap(ctx context.Context, channelUsername string, fromID, toID int64) error {
 	if s == nil || s.db == nil {
 		return errors.New("collector postgres storage: db is nil")
 	}
-	if s.dedupWindow <= 0 {
-		return nil
+	if channelUsername == "" {
+		return errors.New("collector postgres storage: channelUsername is required")
+	}
+	if fromID <= 0 || toID < fromID {
+		return fmt.Errorf("collector postgres storage: invalid gap [%d, %d]", fromID, toID)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO checkpoint_gaps (channel_username, from_message_id, to_message_id, created_at, updated_at)
+VALUES ($1, $2, $3, NOW(), NOW())
+`, channelUsername, fromID, toID)
+	if err != nil {
+		return fmt.Errorf("collector postgres add scan gap: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) UpdateScanGap(ctx context.Context, id, toID int64) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
 	}
 
-	cutoff := time.Now().UTC().Add(-s.dedupWindow)
+	_, err := s.db.ExecContext(ctx, `
+DELETE FROM checkpoint_gaps
+WHERE id = $1
+  AND from_message_id > $2
+`, id, toID)
+	if err != nil {
+		return fmt.Errorf("collector postgres close scan gap: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+UPDATE checkpoint_gaps
+SET to_message_id = $2,
+    updated_at = NOW()
+WHERE id = $1
+  AND from_message_id <= $2
+`, id, toID)
+	if err != nil {
+		return fmt.Errorf("collector postgres update scan gap: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) GetResolvedPeer(ctx context.Context, account, sourceKey string) (ResolvedPeer, bool, error) {
+	if s == nil || s.db == nil {
+		return ResolvedPeer{}, false, errors.New("collector postgres storage: db is nil")
+	}
+	if account == "" || sourceKey == "" {
+		return ResolvedPeer{}, false, errors.New("collector postgres storage: account and sourceKey are required")
+	}
+
+	var p ResolvedPeer
+	err := s.db.QueryRowContext(ctx, `
+SELECT channel_id, access_hash, title, username
+FROM resolved_peers
+WHERE account = $1
+  AND source_key = $2
+`, account, sourceKey).Scan(&p.ChannelID, &p.AccessHash, &p.Title, &p.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ResolvedPeer{}, false, nil
+		}
+		return ResolvedPeer{}, false, fmt.Errorf("collector postgres get resolved peer: %w", err)
+	}
+
+	return p, true, nil
+}
+
+func (s *Postgres) SaveResolvedPeer(ctx context.Context, account, sourceKey string, p ResolvedPeer) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if account == "" || sourceKey == "" || p.ChannelID <= 0 {
+		return errors.New("collector postgres storage: account, sourceKey and channel_id are required")
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO resolved_peers (account, source_key, channel_id, access_hash, title, username, resolved_at, updated_at)
+VALUES ($6, $1, $2, $3, $4, $5, NOW(), NOW())
+ON CONFLICT (account, source_key)
+DO UPDATE SET
+	channel_id = EXCLUDED.channel_id,
+	access_hash = EXCLUDED.access_hash,
+	title = EXCLUDED.title,
+	username = EXCLUDED.username,
+	resolved_at = EXCLUDED.resolved_at,
+	updated_at = EXCLUDED.updated_at
+`, sourceKey, p.ChannelID, p.AccessHash, p.Title, p.Username, account)
+	if err != nil {
+		return fmt.Errorf("collector postgres save resolved peer: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) DeleteResolvedPeer(ctx context.Context, account, sourceKey string) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+DELETE FROM resolved_peers
+WHERE account = $1
+  AND source_key = $2
+`, account, sourceKey)
+	if err != nil {
+		return fmt.Errorf("collector postgres delete resolved peer: %w", err)
+	}
+
+	return nil
+}
+
+// ArchiveMessage обновляет уже лежащее сообщение, только если пришла более свежая правка,
+// счетчики при этом растут только в большую сторону, как в hits
+func (s *Postgres) ArchiveMessage(ctx context.Context, m Message) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if m.Channel == "" || m.ChannelID <= 0 || m.MessageID <= 0 || m.Link == "" || m.MessageDate.IsZero() {
+		return errors.New("collector postgres storage: invalid message (channel/channel_id/message_id/link/message_date required)")
+	}
+	if m.Group == "" {
+		m.Group = "default"
+	}
+
+	meta, err := json.Marshal(m.Meta)
+	if err != nil {
+		return fmt.Errorf("collector postgres archive message: marshal meta: %w", err)
+	}
+	entities := []byte("[]")
+	if len(m.Entities) > 0 {
+		if entities, err = json.Marshal(m.Entities); err != nil {
+			return fmt.Errorf("collector postgres archive message: marshal entities: %w", err)
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO messages (
+	channel,
+	channel_id,
+	message_id,
+	message_date,
+	edit_date,
+	text,
+	link,
+	channel_group,
+	views,
+	forwards,
+	reactions,
+	meta,
+	entities,
+	archived_at,
+	updated_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW())
+ON CONFLICT (channel_id, message_id)
+DO UPDATE SET
+	channel = EXCLUDED.channel,
+	link = EXCLUDED.link,
+	channel_group = EXCLUDED.channel_group,
+	edit_date = COALESCE(EXCLUDED.edit_date, messages.edit_date),
+	text = CASE WHEN EXCLUDED.edit_date > COALESCE(messages.edit_date, messages.message_date)
+		THEN EXCLUDED.text ELSE messages.text END,
+	meta = CASE WHEN EXCLUDED.edit_date > COALESCE(messages.edit_date, messages.message_date)
+		THEN EXCLUDED.meta ELSE messages.meta END,
+	entities = CASE WHEN EXCLUDED.edit_date > COALESCE(messages.edit_date, messages.message_date)
+		THEN EXCLUDED.entities ELSE messages.entities END,
+	views = GREATEST(messages.views, EXCLUDED.views),
+	forwards = GREATEST(messages.forwards, EXCLUDED.forwards),
+	reactions = GREATEST(messages.reactions, EXCLUDED.reactions),
+	updated_at = EXCLUDED.updated_at
+`,
+		m.Channel, m.ChannelID, m.MessageID, m.MessageDate.UTC(), nullTime(m.EditDate), m.Text, m.Link, m.Group,
+		nullInt(m.Stats.Views), nullInt(m.Stats.Forwards), nullInt(m.Stats.Reactions), string(meta), string(entities),
+	)
+	if err != nil {
+		return fmt.Errorf("collector postgres archive message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) ListArchivedMessages(ctx context.Context, since time.Time, afterID int64, limit int) ([]Message, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("collector postgres storage: db is nil")
+	}
+	if limit <= 0 {
+		limit = 500
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, channel, channel_id, message_id, message_date, edit_date, text, link, channel_group,
+       views, forwards, reactions, meta, entities
+FROM messages
+WHERE id > $1
+  AND message_date >= $2
+ORDER BY id
+LIMIT $3
+`, afterID, since.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("collector postgres list archived messages: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		var (
+			m                          Message
+			editDate                   sql.NullTime
+			views, forwards, reactions sql.NullInt64
+			meta, entities             []byte
+		)
+		if err := rows.Scan(
+			&m.ID, &m.Channel, &m.ChannelID, &m.MessageID, &m.MessageDate, &editDate, &m.Text, &m.Link, &m.Group,
+			&views, &forwards, &reactions, &meta, &entities,
+		); err != nil {
+			return nil, fmt.Errorf("collector postgres list archived messages: scan: %w", err)
+		}
+		if editDate.Valid {
+			m.EditDate = editDate.Time
+		}
+		m.Stats = HitStats{Views: intPtr(views), Forwards: intPtr(forwards), Reactions: intPtr(reactions)}
+		if len(meta) > 0 {
+			if err := json.Unmarshal(meta, &m.Meta); err != nil {
+				return nil, fmt.Errorf("collector postgres list archived messages: meta: %w", err)
+			}
+		}
+		if len(entities) > 0 {
+			if err := json.Unmarshal(entities, &m.Entities); err != nil {
+				return nil, fmt.Errorf("collector postgres list archived messages: entities: %w", err)
+			}
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("collector postgres list archived messages: rows: %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *Postgres) PruneMessages(ctx context.Context, before time.Time) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("collector postgres storage: db is nil")
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+DELETE FROM messages
+WHERE message_date < $1
+`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("collector postgres prune messages: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (s *Postgres) LoadMTProtoSession(ctx context.Context, account string) ([]byte, bool, error) {
+	if s == nil || s.db == nil {
+		return nil, false, errors.New("collector postgres storage: db is nil")
+	}
+	if account == "" {
+		return nil, false, errors.New("collector postgres storage: account is required")
+	}
+
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+SELECT data
+FROM mtproto_sessions
+WHERE account = $1
+`, account).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("collector postgres load mtproto session: %w", err)
+	}
+
+	return data, true, nil
+}
+
+func (s *Postgres) StoreMTProtoSession(ctx context.Context, account string, data []byte) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if account == "" || len(data) == 0 {
+		return errors.New("collector postgres storage: account and data are required")
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO mtproto_sessions (account, data, created_at, updated_at)
+VALUES ($1, $2, NOW(), NOW())
+ON CONFLICT (account)
+DO UPDATE SET
+	data = EXCLUDED.data,
+	updated_at = EXCLUDED.updated_at
+`, account, data)
+	if err != nil {
+		return fmt.Errorf("collector postgres store mtproto session: %w", err)
+	}
+
+	return nil
+}
+
+// AdoptChannelHits пропускает hits, для которых под новым именем уже есть такое же сообщение:
+// уникальность (channel, message_id) важнее, такие дубли остаются под старым именем
+func (s *Postgres) AdoptChannelHits(ctx context.Context, channelID int64, channel, linkBase string) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("collector postgres storage: db is nil")
+	}
+	if channelID <= 0 || channel == "" || linkBase == "" {
+		return 0, errors.New("collector postgres storage: channel_id, channel and link base are required")
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+UPDATE hits h
+SET channel = $2,
+    channel_id = $1,
+    link = CASE WHEN h.channel <> $2 THEN $3 || '/' || h.message_id ELSE h.link END
+WHERE (h.channel_id = $1 OR (h.channel = $2 AND h.channel_id IS NULL))
+  AND (h.channel <> $2 OR h.channel_id IS NULL)
+  AND NOT EXISTS (
+        SELECT 1
+        FROM hits o
+        WHERE o.channel = $2
+          AND o.message_id = h.message_id
+          AND o.id <> h.id
+      )
+`, channelID, channel, linkBase)
+	if err != nil {
+		return 0, fmt.Errorf("collector postgres adopt channel hits: %w", err)
+	}
+
+	affected, _ := res.RowsAffected()
+	return int(affected), nil
+}
+
+func (s *Postgres) GetBackfillState(ctx context.Context, channelUsername string) (BackfillState, error) {
+	if s == nil || s.db == nil {
+		return BackfillState{}, errors.New("collector postgres storage: db is nil")
+	}
+	if channelUsername == "" {
+		return BackfillState{}, errors.New("collector postgres storage: channelUsername is required")
+	}
+
+	var (
+		oldestID    sql.NullInt64
+		oldestDate  sql.NullTime
+		completedAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `
+SELECT oldest_message_id, oldest_message_date, backfill_completed_at
+FROM checkpoints
+WHERE channel_username = $1
+`, channelUsername).Scan(&oldestID, &oldestDate, &completedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return BackfillState{}, nil
+		}
+		return BackfillState{}, fmt.Errorf("collector postgres get backfill state: %w", err)
+	}
+
+	return BackfillState{
+		OldestMessageID:   oldestID.Int64,
+		OldestMessageDate: oldestDate.Time.UTC(),
+		Completed:         completedAt.Valid,
+	}, nil
+}
+
+// SetBackfillState не трогает last_message_id: если строки еще нет,
+// создает ее с нулевым last_message_id, и инкрементальный обход начнет как с нуля
+func (s *Postgres) SetBackfillState(ctx context.Context, channelUsername string, st BackfillState) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
+	if channelUsername == "" {
+		return errors.New("collector postgres storage: channelUsername is required")
+	}
+
+	var oldestID sql.NullInt64
+	if st.OldestMessageID > 0 {
+		oldestID = sql.NullInt64{Int64: st.OldestMessageID, Valid: true}
+	}
+	var completedAt sql.NullTime
+	if st.Completed {
+		completedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO checkpoints (channel_username, last_message_id, oldest_message_id, oldest_message_date, backfill_completed_at, updated_at)
+VALUES ($1, 0, $2, $3, $4, NOW())
+ON CONFLICT (channel_username)
+DO UPDATE SET
+	oldest_message_id = EXCLUDED.oldest_message_id,
+	oldest_message_date = EXCLUDED.oldest_message_date,
+	backfill_completed_at = EXCLUDED.backfill_completed_at,
+	updated_at = EXCLUDED.updated_at
+`, channelUsername, oldestID, nullTime(st.OldestMessageDate), completedAt)
+	if err != nil {
+		return fmt.Errorf("collector postgres set backfill state: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) LoadRegistry(ctx context.Context) (Registry, error) {
+	if s == nil || s.db == nil {
+		return Registry{}, errors.New("collector postgres storage: db is nil")
+	}
+
+	channels, err := s.loadRegistryItems(ctx, `
+SELECT ref, group_name
+FROM channels
+WHERE enabled
+ORDER BY id ASC
+`)
+	if err != nil {
+		return Registry{}, fmt.Errorf("collector postgres load channels: %w", err)
+	}
+
+	keywords, err := s.loadRegistryItems(ctx, `
+SELECT expression, group_name
+FROM keywords
+WHERE enabled
+ORDER BY id ASC
+`)
+	if err != nil {
+		return Registry{}, fmt.Errorf("collector postgres load keywords: %w", err)
+	}
+
+	return Registry{Channels: channels, Keywords: keywords}, nil
+}
+
+func (s *Postgres) loadRegistryItems(ctx context.Context, query string) ([]RegistryItem, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]RegistryItem, 0, 16)
+	for rows.Next() {
+		var it RegistryItem
+		if err := rows.Scan(&it.Value, &it.Group); err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (s *Postgres) SeedRegistry(ctx context.Context, r Registry, addedBy string) (int, int, error) {
+	if s == nil || s.db == nil {
+		return 0, 0, errors.New("collector postgres storage: db is nil")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("collector postgres seed registry: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	channels, err := seedTable(ctx, tx,
+		`SELECT EXISTS (SELECT 1 FROM channels)`,
+		`INSERT INTO channels (ref, group_name, added_by, notes) VALUES ($1, $2, $3, 'seeded from config') ON CONFLICT (ref) DO NOTHING`,
+		r.Channels, addedBy)
+	if err != nil {
+		return 0, 0, fmt.Errorf("collector postgres seed channels: %w", err)
+	}
+
+	keywords, err := seedTable(ctx, tx,
+		`SELECT EXISTS (SELECT 1 FROM keywords)`,
+		`INSERT INTO keywords (expression, group_name, added_by, notes) VALUES ($1, $2, $3, 'seeded from config') ON CONFLICT (group_name, expression) DO NOTHING`,
+		r.Keywords, addedBy)
+	if err != nil {
+		return 0, 0, fmt.Errorf("collector postgres seed keywords: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("collector postgres seed registry: commit: %w", err)
+	}
+
+	return channels, keywords, nil
+}
+
+func seedTable(ctx context.Context, tx *sql.Tx, existsQuery, insertQuery string, items []RegistryItem, addedBy string) (int, error) {
+	var exists bool
+	if err := tx.QueryRowContext(ctx, existsQuery).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, nil
+	}
+
+	inserted := 0
+	for _, it := range items {
+		res, err := tx.ExecContext(ctx, insertQuery, it.Value, it.Group, addedBy)
+		if err != nil {
+			return inserted, err
+		}
+		affected, _ := res.RowsAffected()
+		inserted += int(affected)
+	}
+	return inserted, nil
+}
+
+// ListExpiredHits выгружает каждый hit одной JSON строкой: колонки hits
+// (без производных search_text и служебной блокировки classifier)
+// плюс hit_keywords, hit_entities, hit_versions и hit_media, которые удалятся вместе с ним
+func (s *Postgres) ListExpiredHits(ctx context.Context, before time.Time, limit int) ([]ExpiredHit, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("collector postgres storage: db is nil")
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT h.id,
+       ((to_jsonb(h) - 'search_text' - 'search_text_normalized' - 'processing_by' - 'processing_until')
+           || jsonb_build_object(
+               'keywords', COALESCE((
+                   SELECT jsonb_agg(jsonb_build_object('keyword', k.keyword, 'start', k.start_offset, 'end', k.end_offset) ORDER BY k.id)
+                   FROM hit_keywords k
+                   WHERE k.hit_id = h.id
+               ), '[]'::jsonb),
+               'entities', COALESCE((
+                   SELECT jsonb_agg(to_jsonb(e) - 'hit_id' - 'id' ORDER BY e.id)
+                   FROM hit_entities e
+                   WHERE e.hit_id = h.id
+               ), '[]'::jsonb),
+               'versions', COALESCE((
+                   SELECT jsonb_agg(to_jsonb(v) - 'hit_id' ORDER BY v.version)
+                   FROM hit_versions v
+                   WHERE v.hit_id = h.id
+               ), '[]'::jsonb),
+               'media', COALESCE((
+                   SELECT jsonb_agg(to_jsonb(m) - 'hit_id' ORDER BY m.id)
+                   FROM hit_media m
+                   WHERE m.hit_id = h.id
+               ), '[]'::jsonb)
+           ))::text
+FROM hits h
+WHERE h.created_at < $1
+ORDER BY h.created_at, h.id
+LIMIT $2
+`, before.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("collector postgres list expired hits: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ExpiredHit
+	for rows.Next() {
+		var (
+			h   ExpiredHit
+			raw string
+		)
+		if err := rows.Scan(&h.ID, &raw); err != nil {
+			return nil, fmt.Errorf("collector postgres list expired hits: scan: %w", err)
+		}
+		h.JSON = []byte(raw)
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("collector postgres list expired hits: rows: %w", err)
+	}
+
+	return out, nil
+}
+
+// Prune удаляет только hits, checkpoints и прочее состояние обхода не трогает:
+// по ним обход не вернется к старым сообщениям и не вставит их заново
+//
+// hit_media уходит каскадом, а файлы на диске остаются, поэтому заодно отдаем пути файлов,
+// на которые после удаления больше не ссылается ни один hit (файлы общие по sha256).
+// Это только кандидаты: удалять их через RemoveMediaFile, он перепроверит под блокировкой.
+// Все части запроса видят один снимок, так что hit_media здесь еще со строками удаленных hits
+//
+// первый hit истории старше своих копий и удаляется раньше них, поэтому копии
+// переводим на следующий по id, как в moveStory: иначе история осталась бы без первого hit,
+// и classifier ее бы не классифицировал
+func (s *Postgres) Prune(ctx context.Context, before time.Time, ids []int64) (int, []string, error) {
+	if s == nil || s.db == nil {
+		return 0, nil, errors.New("collector postgres storage: db is nil")
+	}
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, before.UTC())
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+WITH gone AS (
+    DELETE FROM hits
+    WHERE created_at < $1
+      AND id IN (`+pgPlaceholders(2, len(ids))+`)
+    RETURNING id
+),
+heads AS (
+    SELECT o.story_id, MIN(o.id) AS id
+    FROM hits o
+    WHERE o.story_id IN (SELECT id FROM gone)
+      AND o.id NOT IN (SELECT id FROM gone)
+    GROUP BY o.story_id
+),
+moved AS (
+    UPDATE hits h
+    SET story_id = heads.id
+    FROM heads
+    WHERE h.story_id = heads.story_id
+      AND h.id NOT IN (SELECT id FROM gone)
+)
+SELECT g.id, m.path
+FROM gone g
+LEFT JOIN hit_media m
+  ON m.hit_id = g.id
+ AND NOT EXISTS (
+     SELECT 1
+     FROM hit_media o
+     WHERE o.path = m.path
+       AND o.hit_id NOT IN (SELECT id FROM gone)
+ )
+`, args...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("collector postgres prune hits: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		pruned = make(map[int64]struct{}, len(ids))
+		seen   = make(map[string]struct{})
+		paths  []string
+	)
+	for rows.Next() {
+		var (
+			id   int64
+			path sql.NullString
+		)
+		if err := rows.Scan(&id, &path); err != nil {
+			return 0, nil, fmt.Errorf("collector postgres prune hits: scan: %w", err)
+		}
+		pruned[id] = struct{}{}
+		if _, ok := seen[path.String]; path.Valid && !ok {
+			seen[path.String] = struct{}{}
+			paths = append(paths, path.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("collector postgres prune hits: rows: %w", err)
+	}
+
+	return len(pruned), paths, nil
+}
+
+// RemoveMediaFile вызывает remove, только если на path уже не ссылается ни один hit
+// проверка и remove идут под той же блокировкой пути, что и SaveHitMedia
+func (s *Postgres) RemoveMediaFile(ctx context.Context, path string, remove func() error) (bool, error) {
+	if s == nil || s.db == nil {
+		return false, errors.New("collector postgres storage: db is nil")
+	}
+	if path == "" {
+		return false, errors.New("collector postgres storage: media path is required")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("collector postgres remove media file: begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := lockMediaPath(ctx, tx, path); err != nil {
+		return false, err
+	}
+
+	var used bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM hit_media WHERE path = $1)`, path).Scan(&used); err != nil {
+		return false, fmt.Errorf("collector postgres remove media file: %w", err)
+	}
+	if used {
+		return false, nil
+	}
+	if err := remove(); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("collector postgres remove media file: commit: %w", err)
+	}
+	return true, nil
+}
+
+// lockMediaPath берет транзакционную advisory блокировку на путь файла медиа
+func lockMediaPath(ctx context.Context, tx *sql.Tx, path string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, path); err != nil {
+		return fmt.Errorf("collector postgres lock media path: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) RecordRetentionRun(ctx context.Context, r RetentionRun) error {
+	if s == nil || s.db == nil {
+		return errors.New("collector postgres storage: db is nil")
+	}
 
 	_, err := s.db.ExecContext(ctx, `
-DELETE FROM hits
-WHERE created_at < $1
-`, cutoff)
+INSERT INTO retention_runs (started_at, finished_at, cutoff, archived, pruned, file, error)
+VALUES ($1, NOW(), $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+`, r.StartedAt.UTC(), r.Cutoff.UTC(), r.Archived, r.Pruned, r.File, r.Error)
 	if err != nil {
-		return fmt.Errorf("collector postgres prune hits: %w", err)
+		return fmt.Errorf("collector postgres record retention run: %w", err)
 	}
 
 	return nil
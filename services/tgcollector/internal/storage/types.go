@@ -6,20 +6,258 @@ import (
 )
 
 type Hit struct {
-	Channel     string
+	Channel string
+	// ChannelID это id канала в Telegram, не меняется при переименовании, 0 если неизвестен
+	ChannelID   int64
 	MessageID   int64
 	MessageDate time.Time
 	Text        string
 	Link        string
 	Keyword     string
+	Group       string
+
+	// TextHTML это Text с разметкой Telegram в виде HTML для Bot API,
+	// пусто если рисовать нечего (тогда показывают Text)
+	TextHTML string
+
+	// EditDate это edit_date из Telegram, нулевой если сообщение не редактировали
+	EditDate time.Time
+
+	// Keywords это все сработавшие выражения, Keyword дублирует первое из них
+	Keywords []HitKeyword
+
+	// Entities это разметка Telegram в Text, пусто если текст hit взят из метаданных
+	Entities []HitEntity
+
+	Meta  HitMeta
+	Stats HitStats
+
+	// Silent сохраняет hit сразу с delivered_at, notifier его не отправит
+	Silent bool
+}
+
+// HitMeta это медиа и прочие метаданные сообщения, лежат в hits.meta (jsonb)
+// media_type и fwd_from дублируются в отдельные колонки для фильтров
+type HitMeta struct {
+	MediaType string `json:"media_type,omitempty"`
+	FileName  string `json:"file_name,omitempty"`
+	MimeType  string `json:"mime_type,omitempty"`
+
+	WebPageURL         string `json:"webpage_url,omitempty"`
+	WebPageSite        string `json:"webpage_site,omitempty"`
+	WebPageTitle       string `json:"webpage_title,omitempty"`
+	WebPageDescription string `json:"webpage_description,omitempty"`
+
+	PollQuestion string `json:"poll_question,omitempty"`
+
+	FwdFrom        string `json:"fwd_from,omitempty"`
+	FwdChannelPost int    `json:"fwd_channel_post,omitempty"`
+	PostAuthor     string `json:"post_author,omitempty"`
+	GroupedID      int64  `json:"grouped_id,omitempty"`
+	Replies        int    `json:"replies,omitempty"`
+}
+
+// HitStats это счетчики сообщения, nil если Telegram их не прислал
+// при повторном обходе обновляются, но только в большую сторону
+type HitStats struct {
+	Views     *int
+	Forwards  *int
+	Reactions *int
+}
+
+// HitKeyword это одно сработавшее выражение и позиции совпадений в тексте (в рунах)
+// у выражений только из NOT позиций нет
+type HitKeyword struct {
+	Keyword string
+	Spans   []Span
 }
 
+type Span struct {
+	Start int
+	End   int
+}
+
+// HitEntity это разметка Telegram в тексте (ссылка, упоминание, хештег, жирный и т.п.), лежит в hit_entities
+// Start/End в рунах, как у Span. Value: адрес ссылки, имя без @, хештег без #
+// (имена и хештеги в нижнем регистре), у чистого форматирования пусто.
+// Domain есть только у ссылок, без www.
+type HitEntity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Value  string `json:"value,omitempty"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// HitMedia это скачанный файл из сообщения, лежит в hit_media
+type HitMedia struct {
+	Kind      string
+	MimeType  string
+	FileName  string
+	SizeBytes int64
+	SHA256    string
+	Path      string
+}
+
+// Message это просмотренное сообщение из архива messages, подходило оно под выражения или нет
+// по архиву rematch находит старые сообщения под новые выражения, не перечитывая Telegram
+type Message struct {
+	// ID это id строки в messages, курсор для ListArchivedMessages
+	ID int64
+
+	Channel     string
+	ChannelID   int64
+	MessageID   int64
+	MessageDate time.Time
+	EditDate    time.Time
+	Text        string
+	Link        string
+	Group       string
+
+	Entities []HitEntity
+
+	Meta  HitMeta
+	Stats HitStats
+}
+
+// StoryConfig это склейка почти одинаковых hits из разных каналов в одну историю (hits.story_id)
+// Window = 0 выключает склейку: каждый hit тогда сам себе история
+type StoryConfig struct {
+	Window      time.Duration
+	MaxDistance int
+	MinWords    int
+}
+
+// ExpiredHit это hit старше dedup_window, выгруженный одной JSON строкой перед удалением
+type ExpiredHit struct {
+	ID   int64
+	JSON []byte
+}
+
+// RetentionRun это итог одного прогона retention, лежит в retention_runs
+// Error пустой, если прогон прошел до конца
+type RetentionRun struct {
+	StartedAt time.Time
+	Cutoff    time.Time
+	Archived  int
+	Pruned    int
+	File      string
+	Error     string
+}
+
+// BackfillState это нижняя граница уже пройденной истории канала
+// OldestMessageID = 0 значит backfill по каналу еще не начинали
+type BackfillState struct {
+	OldestMessageID   int64
+	OldestMessageDate time.Time
+	Completed         bool
+}
+
+// ScanGap это непросмотренный диапазон message_id [FromID, ToID] за чекпоинтом канала
+// появляется, когда обход уперся в per_channel_max_scan, не дойдя до last_message_id
+type ScanGap struct {
+	ID     int64
+	FromID int64
+	ToID   int64
+}
+
+// ResolvedPeer это канал, найденный по источнику, из resolved_peers
+// с ним обход не зовет contacts.resolveUsername на каждом проходе
+type ResolvedPeer struct {
+	ChannelID  int64
+	AccessHash int64
+	Title      string
+	Username   string
+}
+
+// Registry это каналы и ключевые выражения из таблиц channels и keywords
+// в Load попадают только enabled записи
+type Registry struct {
+	Channels []RegistryItem
+	Keywords []RegistryItem
+}
+
+// RegistryItem это канал или выражение вместе с группой, к которой оно относится
+type RegistryItem struct {
+	Value string
+	Group string
+}
+
+// SaveResult говорит, что SaveHit сделал с сообщением
+type SaveResult int
+
+const (
+	// SaveSkipped: такой hit уже есть и новее нашей версии ничего нет
+	SaveSkipped SaveResult = iota
+	// SaveInserted: новый hit
+	SaveInserted
+	// SaveUpdated: hit уже был, сообщение отредактировали, старый текст ушел в hit_versions
+	SaveUpdated
+)
+
 type Store interface {
-	SaveHit(ctx context.Context, h Hit) (inserted bool, err error)
+	// SaveHit вставляет hit, а если он уже есть и у h более свежий EditDate,
+	// обновляет текст и сохраняет прошлую версию
+	SaveHit(ctx context.Context, h Hit) (SaveResult, error)
+
+	LoadRegistry(ctx context.Context) (Registry, error)
+	// SeedRegistry заливает записи в пустые таблицы и ничего не делает если там уже что-то есть
+	SeedRegistry(ctx context.Context, r Registry, addedBy string) (channels int, keywords int, err error)
+
+	// SaveHitMedia записывает файл медиа hit, place кладет файл на диск под блокировкой пути
+	SaveHitMedia(ctx context.Context, channel string, messageID int64, m HitMedia, place func() error) error
+
+	// ListAliveMessageIDs возвращает message_id hits канала не старше since, еще не помеченных удаленными
+	ListAliveMessageIDs(ctx context.Context, channel string, since time.Time) ([]int64, error)
+	MarkDeleted(ctx context.Context, channel string, messageIDs []int64) (int, error)
+
+	// ListQuarantined отдает каналы, обход которых отложен до указанного времени
+	ListQuarantined(ctx context.Context, now time.Time) (map[string]time.Time, error)
+	RecordChannelSuccess(ctx context.Context, channel, stopReason string) error
+	// RecordChannelFailure увеличивает счетчик неудач подряд и возвращает его новое значение
+	RecordChannelFailure(ctx context.Context, channel, lastError string) (int, error)
+	QuarantineChannel(ctx context.Context, channel string, until time.Time) error
 
 	GetCheckpoint(ctx context.Context, channelUsername string) (lastMessageID int64, err error)
 	SetCheckpoint(ctx context.Context, channelUsername string, lastMessageID int64) error
 
-	Prune(ctx context.Context) error
+	// ListScanGaps отдает дыры канала, сначала самые свежие
+	ListScanGaps(ctx context.Context, channelUsername string) ([]ScanGap, error)
+	AddScanGap(ctx context.Context, channelUsername string, fromID, toID int64) error
+	// UpdateScanGap сужает дыру сверху до toID, а если она закрылась (toID < from), удаляет ее
+	UpdateScanGap(ctx context.Context, id, toID int64) error
+
+	// GetResolvedPeer отдает сохраненный канал источника, ok = false если его еще не искали
+	// access_hash у каждого аккаунта свой, поэтому все хранится по аккаунту
+	GetResolvedPeer(ctx context.Context, account, sourceKey string) (ResolvedPeer, bool, error)
+	SaveResolvedPeer(ctx context.Context, account, sourceKey string, p ResolvedPeer) error
+	DeleteResolvedPeer(ctx context.Context, account, sourceKey string) error
+	// AdoptChannelHits переносит hits канала на его текущее имя после переименования
+	// и проставляет channel_id старым hits, у которых его еще нет
+	AdoptChannelHits(ctx context.Context, channelID int64, channel, linkBase string) (int, error)
+
+	// ArchiveMessage кладет сообщение в messages или обновляет его, если сообщение правили
+	ArchiveMessage(ctx context.Context, m Message) error
+	// ListArchivedMessages отдает до limit сообщений не старше since с id > afterID по возрастанию id
+	ListArchivedMessages(ctx context.Context, since time.Time, afterID int64, limit int) ([]Message, error)
+	// PruneMessages удаляет из архива сообщения старше before
+	PruneMessages(ctx context.Context, before time.Time) (int, error)
+
+	// LoadMTProtoSession отдает сессию аккаунта как она сохранена (зашифрованной), ok = false если ее нет
+	LoadMTProtoSession(ctx context.Context, account string) ([]byte, bool, error)
+	StoreMTProtoSession(ctx context.Context, account string, data []byte) error
+
+	GetBackfillState(ctx context.Context, channelUsername string) (BackfillState, error)
+	SetBackfillState(ctx context.Context, channelUsername string, st BackfillState) error
+
+	// ListExpiredHits отдает до limit самых старых hits, созданных раньше before, для архива
+	ListExpiredHits(ctx context.Context, before time.Time, limit int) ([]ExpiredHit, error)
+	// Prune удаляет hits с этими id, если они все еще созданы раньше before,
+	// и отдает пути файлов hit_media, которые после этого больше никому не нужны
+	Prune(ctx context.Context, before time.Time, ids []int64) (int, []string, error)
+	// RemoveMediaFile вызывает remove, если на path не ссылается ни один hit, true если вызвал
+	RemoveMediaFile(ctx context.Context, path string, remove func() error) (bool, error)
+	RecordRetentionRun(ctx context.Context, r RetentionRun) error
+
 	Close() error
 }
@@ -32,6 +32,21 @@ type Notifier struct {
 	MinDelay         time.Duration `mapstructure:"min_delay"`
 	MaxTextRunes     int           `mapstructure:"max_text_runes"`
 	DryRun           bool          `mapstructure:"dry_run"`
+
+	// ChannelGroups ограничивает доставку hit'ами из этих групп каналов, пусто -> все группы
+	ChannelGroups []string `mapstructure:"channel_groups"`
+
+	// AttachMedia прикладывает к уведомлению фото, скачанное collector'ом (hit_media)
+	AttachMedia bool `mapstructure:"attach_media"`
+
+	HealthAlerts HealthAlerts `mapstructure:"health_alerts"`
+}
+
+// HealthAlerts это оповещения в supervisor чат о каналах, которые collector отправил в карантин
+// проверяются раз в Interval, независимо от расписания доставки новостей
+type HealthAlerts struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
 }
 
 func (s *Schedule) setDefaults() {
@@ -85,6 +100,9 @@ func (n *Notifier) setDefaults() {
 	if n.MaxTextRunes <= 0 {
 		n.MaxTextRunes = 300
 	}
+	if n.HealthAlerts.Interval <= 0 {
+		n.HealthAlerts.Interval = 10 * time.Minute
+	}
 }
 
 func (n *Notifier) Validate() error {
@@ -106,6 +124,16 @@ func (n *Notifier) Validate() error {
 	if n.MaxTextRunes <= 0 {
 		return errors.New("notifier.max_text_runes must be > 0")
 	}
+
+	groups := n.ChannelGroups[:0]
+	for _, g := range n.ChannelGroups {
+		g = strings.ToLower(strings.TrimSpace(g))
+		if g != "" {
+			groups = append(groups, g)
+		}
+	}
+	n.ChannelGroups = groups
+
 	return nil
 }
 
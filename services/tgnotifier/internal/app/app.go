@@ -57,6 +57,8 @@ func New(cfg *tgcfg.TGNotifier, log *slog.Logger) (*App, error) {
 			MinDelay:         cfg.Notifier.MinDelay,
 			DryRun:           cfg.Notifier.DryRun,
 			MaxTextRunes:     cfg.Notifier.MaxTextRunes,
+			ChannelGroups:    cfg.Notifier.ChannelGroups,
+			AttachMedia:      cfg.Notifier.AttachMedia,
 		},
 	})
 
@@ -124,6 +126,8 @@ func (a *App) Run(ctx context.Context) error {
 		slog.Int("batch_size", a.cfg.Notifier.BatchSize),
 		slog.Duration("min_delay", a.cfg.Notifier.MinDelay),
 		slog.Int64("supervisor_chat_id", a.cfg.Notifier.SupervisorChatID),
+		slog.Any("channel_groups", a.cfg.Notifier.ChannelGroups),
+		slog.Bool("health_alerts", a.cfg.Notifier.HealthAlerts.Enabled),
 		slog.Int("max_open_conns", a.cfg.Storage.Postgres.MaxOpenConns),
 		slog.Int("max_idle_conns", a.cfg.Storage.Postgres.MaxIdleConns),
 	)
@@ -141,6 +145,15 @@ func (a *App) Run(ctx context.Context) error {
 		}
 	}
 
+	var healthC <-chan time.Time
+	if a.cfg.Notifier.HealthAlerts.Enabled {
+		a.runHealthAlerts(ctx)
+
+		t := time.NewTicker(a.cfg.Notifier.HealthAlerts.Interval)
+		defer t.Stop()
+		healthC = t.C
+	}
+
 	for {
 		next := nextScheduledTime(time.Now().In(loc), hour, minute)
 		wait := time.Until(next)
@@ -151,17 +164,34 @@ func (a *App) Run(ctx context.Context) error {
 		)
 
 		timer := time.NewTimer(wait)
-		select {
-		case <-ctx.Done():
-			timer.Stop()
-			a.log.Info("shutdown", slog.Any("err", ctx.Err()))
-			return ctx.Err()
-		case <-timer.C:
-			a.runWindow(ctx, "scheduled", next)
+	waitNext:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				a.log.Info("shutdown", slog.Any("err", ctx.Err()))
+				return ctx.Err()
+			case <-healthC:
+				a.runHealthAlerts(ctx)
+			case <-timer.C:
+				a.runWindow(ctx, "scheduled", next)
+				break waitNext
+			}
 		}
 	}
 }
 
+func (a *App) runHealthAlerts(ctx context.Context) {
+	sent, err := a.notifier.AlertQuarantined(ctx)
+	if err != nil {
+		a.log.Error("health alerts failed", slog.Any("err", err))
+		return
+	}
+	if sent > 0 {
+		a.log.Info("health alerts sent", slog.Int("count", sent))
+	}
+}
+
 func (a *App) runWindow(ctx context.Context, reason string, cutoff time.Time) {
 	start := time.Now()
 
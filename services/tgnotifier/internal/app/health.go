@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/faringet/telegram-bot-scraper/services/tgnotifier/internal/storage"
+)
+
+// maxAlertErrorRunes обрезает текст ошибки канала в оповещении
+const maxAlertErrorRunes = 300
+
+// AlertQuarantined шлет в supervisor чат по сообщению на каждый новый карантин канала
+func (n *Notifier) AlertQuarantined(ctx context.Context) (int, error) {
+	channels, err := n.store.ListUnalertedQuarantined(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list quarantined channels: %w", err)
+	}
+
+	alerted := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		if _, err := n.bot.SendText(ctx, n.cfg.SupervisorChatID, healthAlertMessage(ch), "HTML", true); err != nil {
+			n.log.Error("health alert send failed",
+				slog.String("channel", ch.Channel),
+				slog.Any("err", err),
+			)
+			continue
+		}
+		alerted = append(alerted, ch.Channel)
+	}
+
+	if n.cfg.DryRun {
+		return len(alerted), nil
+	}
+	if err := n.store.MarkHealthAlerted(ctx, alerted); err != nil {
+		return len(alerted), fmt.Errorf("mark health alerted: %w", err)
+	}
+	return len(alerted), nil
+}
+
+func healthAlertMessage(ch storage.ChannelHealth) string {
+	lastSuccess := "never"
+	if ch.LastSuccessAt.Valid {
+		lastSuccess = ch.LastSuccessAt.Time.UTC().Format(time.RFC3339)
+	}
+
+	lastErr := strings.TrimSpace(ch.LastError)
+	if lastErr == "" {
+		lastErr = "—"
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "<b>channel quarantined: %s</b>\n\n", html.EscapeString(ch.Channel))
+	fmt.Fprintf(b, "failures in a row: %d\n", ch.ConsecutiveFailures)
+	fmt.Fprintf(b, "last success: %s\n", html.EscapeString(lastSuccess))
+	fmt.Fprintf(b, "paused until: %s\n\n", html.EscapeString(ch.QuarantinedUntil.Format(time.RFC3339)))
+	fmt.Fprintf(b, "last error: %s", html.EscapeString(truncateRunes(lastErr, maxAlertErrorRunes)))
+	return b.String()
+}
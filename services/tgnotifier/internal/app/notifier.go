@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
 	"time"
+	"unicode/utf8"
 
 	"github.com/faringet/telegram-bot-scraper/internal/newsfmt"
 	"github.com/faringet/telegram-bot-scraper/services/tgnotifier/internal/botapi"
@@ -26,6 +28,8 @@ type NotifierConfig struct {
 	MinDelay         time.Duration
 	DryRun           bool
 	MaxTextRunes     int
+	ChannelGroups    []string
+	AttachMedia      bool
 }
 
 type NotifierDeps struct {
@@ -73,7 +77,7 @@ func (n *Notifier) ProcessWindow(ctx context.Context, reason string, cutoff time
 			fetchLimit = n.cfg.BatchSize
 		}
 
-		hits, err := n.store.ListUndeliveredBefore(ctx, fetchLimit, cutoff)
+		hits, err := n.store.ListUndeliveredBefore(ctx, fetchLimit, cutoff, n.cfg.ChannelGroups)
 		if err != nil {
 			return total, fmt.Errorf("list undelivered before: %w", err)
 		}
@@ -96,13 +100,7 @@ func (n *Notifier) ProcessWindow(ctx context.Context, reason string, cutoff time
 
 			msg := n.fmt.HitMessage(hitToView(h))
 
-			_, sendErr := n.bot.SendText(
-				ctx,
-				n.cfg.SupervisorChatID,
-				msg,
-				"HTML",
-				true,
-			)
+			sendErr := n.send(ctx, h, msg)
 			if sendErr != nil {
 				n.log.Error("send failed",
 					slog.String("reason", reason),
@@ -143,6 +141,36 @@ func (n *Notifier) ProcessWindow(ctx context.Context, reason string, cutoff time
 	}
 }
 
+// send отправляет уведомление, с фото если оно есть и это включено
+// подпись к фото ограничена Telegram, длинный текст уходит отдельным сообщением
+func (n *Notifier) send(ctx context.Context, h storage.Hit, msg string) error {
+	if !n.cfg.AttachMedia || !h.PhotoPath.Valid {
+		_, err := n.bot.SendText(ctx, n.cfg.SupervisorChatID, msg, "HTML", true)
+		return err
+	}
+
+	if _, err := os.Stat(h.PhotoPath.String); err != nil {
+		n.log.Warn("media file unavailable, sending text only",
+			slog.Int64("hit_id", h.ID),
+			slog.String("path", h.PhotoPath.String),
+			slog.Any("err", err),
+		)
+		_, err := n.bot.SendText(ctx, n.cfg.SupervisorChatID, msg, "HTML", true)
+		return err
+	}
+
+	if utf8.RuneCountInString(msg) <= botapi.MaxCaptionRunes {
+		_, err := n.bot.SendPhoto(ctx, n.cfg.SupervisorChatID, h.PhotoPath.String, msg, "HTML")
+		return err
+	}
+
+	if _, err := n.bot.SendPhoto(ctx, n.cfg.SupervisorChatID, h.PhotoPath.String, "", ""); err != nil {
+		return err
+	}
+	_, err := n.bot.SendText(ctx, n.cfg.SupervisorChatID, msg, "HTML", true)
+	return err
+}
+
 func takeFreshHits(hits []storage.Hit, attempted map[int64]struct{}, limit int) []storage.Hit {
 	if limit <= 0 {
 		limit = len(hits)
@@ -183,16 +211,31 @@ func hitToView(h storage.Hit) newsfmt.HitView {
 		messageDate = h.MessageDate.UTC()
 	}
 
+	var views, forwards *int
+	if h.Views.Valid {
+		v := int(h.Views.Int64)
+		views = &v
+	}
+	if h.Forwards.Valid {
+		v := int(h.Forwards.Int64)
+		forwards = &v
+	}
+
 	return newsfmt.HitView{
 		ID:          h.ID,
 		Channel:     h.Channel,
 		MessageID:   h.MessageID,
 		MessageDate: messageDate,
 		Text:        h.Text,
+		TextHTML:    h.TextHTML.String,
 		Link:        h.Link,
 		Keyword:     h.Keyword,
+		Keywords:    h.Keywords,
 		Category:    category,
 		Reason:      reason,
 		Confidence:  confidence,
+		MediaType:   h.MediaType.String,
+		Views:       views,
+		Forwards:    forwards,
 	}
 }
@@ -73,6 +73,37 @@ func (c *Client) SendText(ctx context.Context, chatID int64, text string, parseM
 	return sent.MessageID, nil
 }
 
+// MaxCaptionRunes это лимит Telegram на подпись к фото
+const MaxCaptionRunes = 1024
+
+func (c *Client) SendPhoto(ctx context.Context, chatID int64, path string, caption string, parseMode string) (int, error) {
+	if c == nil || c.bot == nil {
+		return 0, errors.New("botapi: client is nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if chatID == 0 {
+		return 0, errors.New("botapi: chatID is required")
+	}
+	if strings.TrimSpace(path) == "" {
+		return 0, errors.New("botapi: photo path is required")
+	}
+
+	msg := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(path))
+	msg.Caption = strings.TrimSpace(caption)
+	if parseMode != "" && msg.Caption != "" {
+		msg.ParseMode = parseMode
+	}
+
+	sent, err := c.bot.Send(msg)
+	if err != nil {
+		return 0, fmt.Errorf("botapi: send photo: %w", err)
+	}
+
+	return sent.MessageID, nil
+}
+
 func (c *Client) Ping(ctx context.Context) error {
 	if c == nil || c.bot == nil {
 		return errors.New("botapi: client is nil")
@@ -27,7 +27,7 @@ func (s *Postgres) Close() error {
 	return s.db.Close()
 }
 
-func (s *Postgres) ListUndeliveredBefore(ctx context.Context, limit int, classifiedBefore time.Time) ([]Hit, error) {
+func (s *Postgres) ListUndeliveredBefore(ctx context.Context, limit int, classifiedBefore time.Time, groups []string) ([]Hit, error) {
 	if s == nil || s.db == nil {
 		return nil, errors.New("notifier postgres storage: db is nil")
 	}
@@ -35,30 +35,84 @@ func (s *Postgres) ListUndeliveredBefore(ctx context.Context, limit int, classif
 		limit = 50
 	}
 
+	args := []any{classifiedBefore.UTC(), limit}
+	groupFilter := ""
+	if len(groups) > 0 {
+		groupFilter = "\n  AND channel_group IN (" + pgPlaceholders(len(args)+1, len(groups)) + ")"
+		for _, g := range groups {
+			args = append(args, g)
+		}
+	}
+
+	// одна история (та же новость в нескольких каналах) уходит одним сообщением:
+	// из нее берем hit с меньшим id, а если из истории уже что-то доставили в эту группу, не берем ничего.
+	// Остальные hits истории MarkDelivered помечает вместе с отправленным
+	//
+	// в пачку попадают самые старые по classified_at, чтобы ничего не зависало,
+	// а внутри пачки первыми уходят самые просматриваемые и пересылаемые
 	rows, err := s.db.QueryContext(ctx, `
-SELECT
-	id,
-	channel,
-	message_id,
-	message_date,
-	text,
-	link,
-	keyword,
-	delivered_at,
-	category,
-	classified_at,
-	llm_model,
-	llm_confidence,
-	llm_reason
-FROM hits
-WHERE delivered_at IS NULL
-  AND category IS NOT NULL
-  AND LOWER(BTRIM(category)) <> 'other'
-  AND classified_at IS NOT NULL
-  AND classified_at <= $1
-ORDER BY classified_at ASC, message_date ASC, id ASC
-LIMIT $2
-`, classifiedBefore.UTC(), limit)
+SELECT *
+FROM (
+	SELECT *
+	FROM (
+		SELECT DISTINCT ON (COALESCE(story_id, id), channel_group)
+			id,
+			channel,
+			message_id,
+			message_date,
+			text,
+			link,
+			keyword,
+			delivered_at,
+			category,
+			classified_at,
+			llm_model,
+			llm_confidence,
+			llm_reason,
+			COALESCE((
+				SELECT STRING_AGG(k.keyword, E'\n' ORDER BY k.first_id)
+				FROM (
+					SELECT hk.keyword, MIN(hk.id) AS first_id
+					FROM hit_keywords hk
+					WHERE hk.hit_id = hits.id
+					GROUP BY hk.keyword
+				) k
+			), keyword) AS keywords,
+			channel_group,
+			media_type,
+			views,
+			forwards,
+			(
+				SELECT hm.path
+				FROM hit_media hm
+				WHERE hm.hit_id = hits.id
+				  AND hm.kind = 'photo'
+				ORDER BY hm.id
+				LIMIT 1
+			) AS photo_path,
+			text_html
+		FROM hits
+		WHERE delivered_at IS NULL
+		  AND deleted_at IS NULL
+		  AND category IS NOT NULL
+		  AND LOWER(BTRIM(category)) <> 'other'
+		  AND classified_at IS NOT NULL
+		  AND classified_at <= $1`+groupFilter+`
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM hits d
+			WHERE d.story_id = hits.story_id
+			  AND d.id <> hits.id
+			  AND d.channel_group IS NOT DISTINCT FROM hits.channel_group
+			  AND d.delivered_at IS NOT NULL
+		  )
+		ORDER BY COALESCE(story_id, id), channel_group, id
+	) story
+	ORDER BY classified_at ASC, message_date ASC, id ASC
+	LIMIT $2
+) batch
+ORDER BY views DESC NULLS LAST, forwards DESC NULLS LAST, classified_at ASC, message_date ASC, id ASC
+`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("notifier postgres list undelivered before: %w", err)
 	}
@@ -67,7 +121,10 @@ LIMIT $2
 	out := make([]Hit, 0, limit)
 
 	for rows.Next() {
-		var h Hit
+		var (
+			h        Hit
+			keywords string
+		)
 		if err := rows.Scan(
 			&h.ID,
 			&h.Channel,
@@ -82,11 +139,19 @@ LIMIT $2
 			&h.LLMModel,
 			&h.LLMConfidence,
 			&h.LLMReason,
+			&keywords,
+			&h.Group,
+			&h.MediaType,
+			&h.Views,
+			&h.Forwards,
+			&h.PhotoPath,
+			&h.TextHTML,
 		); err != nil {
 			return nil, fmt.Errorf("notifier postgres scan hit: %w", err)
 		}
 
 		h.MessageDate = h.MessageDate.UTC()
+		h.Keywords = splitKeywords(keywords)
 		if h.DeliveredAt.Valid {
 			h.DeliveredAt.Time = h.DeliveredAt.Time.UTC()
 		}
@@ -117,11 +182,23 @@ func (s *Postgres) MarkDelivered(ctx context.Context, ids []int64) error {
 		args = append(args, id)
 	}
 
+	// вместе с отправленными помечаем остальные hits их историй в той же группе каналов,
+	// а заодно копии, которые пришли в историю уже после ее доставки
 	query := `
 UPDATE hits
 SET delivered_at = NOW()
 WHERE delivered_at IS NULL
-  AND id IN (` + pgPlaceholders(1, len(ids)) + `)
+  AND (
+      id IN (` + pgPlaceholders(1, len(ids)) + `)
+      OR EXISTS (
+          SELECT 1
+          FROM hits d
+          WHERE d.story_id = hits.story_id
+            AND d.id <> hits.id
+            AND d.channel_group IS NOT DISTINCT FROM hits.channel_group
+            AND (d.delivered_at IS NOT NULL OR d.id IN (` + pgPlaceholders(1, len(ids)) + `))
+      )
+  )
 `
 
 	_, err := s.db.ExecContext(ctx, query, args...)
@@ -132,6 +209,76 @@ WHERE delivered_at IS NULL
 	return nil
 }
 
+func (s *Postgres) ListUnalertedQuarantined(ctx context.Context) ([]ChannelHealth, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("notifier postgres storage: db is nil")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT
+	channel,
+	consecutive_failures,
+	COALESCE(last_error, ''),
+	last_success_at,
+	quarantined_until
+FROM channel_health
+WHERE quarantined_until > NOW()
+  AND alerted_at IS NULL
+ORDER BY channel ASC
+`)
+	if err != nil {
+		return nil, fmt.Errorf("notifier postgres list quarantined: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]ChannelHealth, 0, 4)
+	for rows.Next() {
+		var ch ChannelHealth
+		if err := rows.Scan(
+			&ch.Channel,
+			&ch.ConsecutiveFailures,
+			&ch.LastError,
+			&ch.LastSuccessAt,
+			&ch.QuarantinedUntil,
+		); err != nil {
+			return nil, fmt.Errorf("notifier postgres scan channel health: %w", err)
+		}
+		ch.QuarantinedUntil = ch.QuarantinedUntil.UTC()
+		out = append(out, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("notifier postgres rows: %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *Postgres) MarkHealthAlerted(ctx context.Context, channels []string) error {
+	if s == nil || s.db == nil {
+		return errors.New("notifier postgres storage: db is nil")
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(channels))
+	for _, ch := range channels {
+		args = append(args, ch)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+UPDATE channel_health
+SET alerted_at = NOW()
+WHERE alerted_at IS NULL
+  AND channel IN (`+pgPlaceholders(1, len(channels))+`)
+`, args...)
+	if err != nil {
+		return fmt.Errorf("notifier postgres mark health alerted: %w", err)
+	}
+
+	return nil
+}
+
 func pgPlaceholders(start, n int) string {
 	parts := make([]string, n)
 	for i := 0; i < n; i++ {
@@ -139,3 +286,15 @@ func pgPlaceholders(start, n int) string {
 	}
 	return strings.Join(parts, ",")
 }
+
+func splitKeywords(s string) []string {
+	parts := strings.Split(s, "\n")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -14,16 +14,43 @@ type Hit struct {
 	Text          string
 	Link          string
 	Keyword       string
+	Keywords      []string
+	Group         string
 	DeliveredAt   sql.NullTime
 	Category      sql.NullString
 	ClassifiedAt  sql.NullTime
 	LLMModel      sql.NullString
 	LLMConfidence sql.NullFloat64
 	LLMReason     sql.NullString
+	MediaType     sql.NullString
+	Views         sql.NullInt64
+	Forwards      sql.NullInt64
+	// PhotoPath это первое скачанное фото из hit_media
+	PhotoPath sql.NullString
+	// TextHTML это текст с разметкой из поста, NULL если collector ее не нашел
+	TextHTML sql.NullString
+}
+
+// ChannelHealth это канал в карантине из channel_health
+type ChannelHealth struct {
+	Channel             string
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccessAt       sql.NullTime
+	QuarantinedUntil    time.Time
 }
 
 type Store interface {
-	ListUndeliveredBefore(ctx context.Context, limit int, classifiedBefore time.Time) ([]Hit, error)
+	// ListUndeliveredBefore отдает классифицированные и не доставленные hit'ы
+	// пустой groups значит без фильтра по группе каналов
+	// из limit самых старых первыми идут те, у кого больше просмотров и пересылок
+	// от каждой истории (копий одной новости) приходит не больше одного hit
+	ListUndeliveredBefore(ctx context.Context, limit int, classifiedBefore time.Time, groups []string) ([]Hit, error)
+	// MarkDelivered помечает доставленными эти hits и остальные hits их историй
 	MarkDelivered(ctx context.Context, ids []int64) error
+
+	// ListUnalertedQuarantined отдает каналы в карантине, о которых еще не оповещали
+	ListUnalertedQuarantined(ctx context.Context) ([]ChannelHealth, error)
+	MarkHealthAlerted(ctx context.Context, channels []string) error
 	Close() error
 }
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	platformpg "github.com/faringet/telegram-bot-scraper/internal/platform/postgres"
 	tgcfg "github.com/faringet/telegram-bot-scraper/services/tgsearchbot/config"
@@ -158,7 +161,14 @@ func (a *App) handleUpdate(ctx context.Context, upd tgbotapi.Update) error {
 		case "search":
 			return a.replySearch(ctx, msg.Chat.ID, msg.CommandArguments())
 
+		case "hit":
+			return a.replyHit(ctx, msg.Chat.ID, msg.CommandArguments())
+
 		default:
+			// /hit_123 из ссылки под результатом поиска
+			if id, ok := strings.CutPrefix(msg.Command(), "hit_"); ok {
+				return a.replyHit(ctx, msg.Chat.ID, id)
+			}
 			return a.bot.SendHTML(ctx, msg.Chat.ID, bottext.UnknownCommand, true)
 		}
 	}
@@ -217,6 +227,44 @@ func (a *App) replySearch(ctx context.Context, chatID int64, rawQuery string) er
 	return nil
 }
 
+func (a *App) replyHit(ctx context.Context, chatID int64, rawID string) error {
+	id, err := strconv.ParseInt(strings.TrimSpace(rawID), 10, 64)
+	if err != nil || id <= 0 {
+		return a.bot.SendHTML(ctx, chatID, bottext.HitUsage, true)
+	}
+
+	d, ok, err := a.searcher.Detail(ctx, id)
+	if err != nil {
+		a.log.Error("hit detail failed",
+			slog.Int64("hit_id", id),
+			slog.Any("err", err),
+		)
+		return a.bot.SendHTML(ctx, chatID, bottext.SearchError, true)
+	}
+	if !ok {
+		return a.bot.SendHTML(ctx, chatID, bottext.HitNotFound, true)
+	}
+
+	if d.PhotoPath != "" {
+		if _, err := os.Stat(d.PhotoPath); err == nil {
+			if utf8.RuneCountInString(d.Text) <= botapi.MaxCaptionRunes {
+				return a.bot.SendPhoto(ctx, chatID, d.PhotoPath, d.Text)
+			}
+			if err := a.bot.SendPhoto(ctx, chatID, d.PhotoPath, ""); err != nil {
+				return err
+			}
+		} else {
+			a.log.Warn("media file unavailable",
+				slog.Int64("hit_id", id),
+				slog.String("path", d.PhotoPath),
+				slog.Any("err", err),
+			)
+		}
+	}
+
+	return a.bot.SendHTML(ctx, chatID, d.Text, true)
+}
+
 func safeUsername(msg *tgbotapi.Message) string {
 	if msg == nil || msg.From == nil || strings.TrimSpace(msg.From.UserName) == "" {
 		return ""
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchQuery это разобранный запрос пользователя
+//
+// фильтр по ключевому слову задается как keyword:сбер или kw:"сбор данных",
+// по группе каналов как group:hr, по разметке сообщения как domain:rbc.ru,
+// mention:@durov и tag:#выборы, sort:views ставит вперед самые просматриваемые,
+// все остальное уходит в полнотекстовый поиск
+type searchQuery struct {
+	Text    string
+	Keyword string
+	Group   string
+	Domain  string
+	Mention string
+	Hashtag string
+	ByViews bool
+}
+
+var (
+	keywordFilterPrefixes = []string{"keyword:", "kw:"}
+	groupFilterPrefixes   = []string{"group:"}
+	domainFilterPrefixes  = []string{"domain:", "site:"}
+	mentionFilterPrefixes = []string{"mention:"}
+	hashtagFilterPrefixes = []string{"tag:", "hashtag:"}
+)
+
+const sortByViews = "sort:views"
+
+func parseSearchQuery(raw string) searchQuery {
+	var (
+		q    searchQuery
+		rest []string
+	)
+
+	for raw = strings.TrimSpace(raw); raw != ""; raw = strings.TrimLeftFunc(raw, unicode.IsSpace) {
+		word, tail := cutWord(raw)
+
+		if strings.EqualFold(word, sortByViews) {
+			q.ByViews = true
+			raw = tail
+			continue
+		}
+
+		var target *string
+		prefix := matchPrefix(word, keywordFilterPrefixes)
+		if prefix != "" {
+			target = &q.Keyword
+		} else if prefix = matchPrefix(word, groupFilterPrefixes); prefix != "" {
+			target = &q.Group
+		} else if prefix = matchPrefix(word, domainFilterPrefixes); prefix != "" {
+			target = &q.Domain
+		} else if prefix = matchPrefix(word, mentionFilterPrefixes); prefix != "" {
+			target = &q.Mention
+		} else if prefix = matchPrefix(word, hashtagFilterPrefixes); prefix != "" {
+			target = &q.Hashtag
+		}
+
+		if target == nil {
+			rest = append(rest, word)
+			raw = tail
+			continue
+		}
+
+		value := raw[len(prefix):]
+		if strings.HasPrefix(value, `"`) {
+			if end := strings.IndexByte(value[1:], '"'); end >= 0 {
+				*target = strings.TrimSpace(value[1 : 1+end])
+				raw = value[end+2:]
+				continue
+			}
+		}
+
+		*target = strings.Trim(strings.TrimSpace(word[len(prefix):]), `"`)
+		raw = tail
+	}
+
+	q.Group = strings.ToLower(q.Group)
+	q.Domain = normalizeDomain(q.Domain)
+	q.Mention = strings.ToLower(strings.TrimPrefix(q.Mention, "@"))
+	q.Hashtag = strings.ToLower(strings.TrimPrefix(q.Hashtag, "#"))
+
+	q.Text = strings.Join(rest, " ")
+	return q
+}
+
+// normalizeDomain приводит домен к виду из hit_entities: https://www.rbc.ru/x -> rbc.ru
+func normalizeDomain(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, rest, ok := strings.Cut(s, "://"); ok {
+		s = rest
+	}
+	if i := strings.IndexAny(s, "/?#:"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimPrefix(s, "www.")
+}
+
+func cutWord(s string) (string, string) {
+	idx := strings.IndexFunc(s, unicode.IsSpace)
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:idx], s[idx:]
+}
+
+func matchPrefix(word string, prefixes []string) string {
+	lower := strings.ToLower(word)
+	for _, p := range prefixes {
+		if strings.HasPrefix(lower, p) {
+			return word[:len(p)]
+		}
+	}
+	return ""
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/faringet/telegram-bot-scraper/internal/newsfmt"
 	"github.com/faringet/telegram-bot-scraper/internal/platform/searchtext"
+	"github.com/faringet/telegram-bot-scraper/services/tgsearchbot/internal/bottext"
 	"github.com/faringet/telegram-bot-scraper/services/tgsearchbot/internal/storage"
 )
 
@@ -24,6 +25,8 @@ type Searcher struct {
 	store storage.Store
 	cfg   SearcherConfig
 	fmt   *newsfmt.Formatter
+	// fullFmt без обрезки текста, для подробного просмотра
+	fullFmt *newsfmt.Formatter
 }
 
 func NewSearcher(log *slog.Logger, st storage.Store, cfg SearcherConfig) *Searcher {
@@ -48,9 +51,10 @@ func NewSearcher(log *slog.Logger, st storage.Store, cfg SearcherConfig) *Search
 			slog.String("layer", "worker"),
 			slog.String("module", "searchbot.searcher"),
 		),
-		store: st,
-		cfg:   cfg,
-		fmt:   newsfmt.NewFormatter(cfg.MaxTextRunes),
+		store:   st,
+		cfg:     cfg,
+		fmt:     newsfmt.NewFormatter(cfg.MaxTextRunes),
+		fullFmt: newsfmt.NewFormatter(detailTextRunes),
 	}
 }
 
@@ -61,37 +65,80 @@ func (s *Searcher) Search(ctx context.Context, rawQuery string) ([]string, error
 	}
 
 	rawQuery = truncateRunes(rawQuery, s.cfg.MaxQueryRunes)
-	normalizedQuery := searchtext.Normalize(rawQuery)
-	if normalizedQuery == "" {
+	q := parseSearchQuery(rawQuery)
+
+	normalizedQuery := searchtext.Normalize(q.Text)
+	if normalizedQuery == "" && q.Keyword == "" && q.Group == "" && q.Domain == "" && q.Mention == "" && q.Hashtag == "" {
 		return nil, errors.New("empty normalized search query")
 	}
 
 	since := time.Now().UTC().Add(-s.cfg.DefaultLookback)
 
-	hits, err := s.store.SearchRecent(ctx, normalizedQuery, since, s.cfg.MaxResults)
+	hits, err := s.store.SearchRecent(ctx, storage.SearchQuery{
+		Normalized: normalizedQuery,
+		Keyword:    q.Keyword,
+		Group:      q.Group,
+		Domain:     q.Domain,
+		Mention:    q.Mention,
+		Hashtag:    q.Hashtag,
+		ByViews:    q.ByViews,
+		Since:      since,
+		Limit:      s.cfg.MaxResults,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]string, 0, len(hits))
 	for _, h := range hits {
-		out = append(out, s.fmt.HitMessage(newsfmt.HitView{
-			ID:          h.ID,
-			Channel:     h.Channel,
-			MessageID:   h.MessageID,
-			MessageDate: h.MessageDate,
-			Text:        h.Text,
-			Link:        h.Link,
-			Keyword:     h.Keyword,
-			Category:    h.Category,
-			Reason:      h.Reason,
-			Confidence:  h.Confidence,
-		}))
+		out = append(out, s.fmt.HitMessage(hitToView(h))+"\n\n"+bottext.DetailLink(h.ID))
 	}
 
 	return out, nil
 }
 
+// detailTextRunes держит подробный просмотр в пределах лимита сообщения Telegram (4096)
+const detailTextRunes = 3500
+
+// HitDetail это подробный просмотр hit: полный текст и фото, если оно скачано
+type HitDetail struct {
+	Text      string
+	PhotoPath string
+}
+
+func (s *Searcher) Detail(ctx context.Context, id int64) (HitDetail, bool, error) {
+	h, ok, err := s.store.GetHit(ctx, id)
+	if err != nil || !ok {
+		return HitDetail{}, ok, err
+	}
+
+	return HitDetail{
+		Text:      s.fullFmt.HitMessage(hitToView(h)),
+		PhotoPath: h.PhotoPath,
+	}, true, nil
+}
+
+func hitToView(h storage.Hit) newsfmt.HitView {
+	return newsfmt.HitView{
+		ID:          h.ID,
+		Channel:     h.Channel,
+		MessageID:   h.MessageID,
+		MessageDate: h.MessageDate,
+		Text:        h.Text,
+		TextHTML:    h.TextHTML,
+		Link:        h.Link,
+		Keyword:     h.Keyword,
+		Keywords:    h.Keywords,
+		Category:    h.Category,
+		Reason:      h.Reason,
+		Confidence:  h.Confidence,
+		MediaType:   h.MediaType,
+		Views:       h.Views,
+		Forwards:    h.Forwards,
+		Deleted:     h.DeletedAt != nil,
+	}
+}
+
 func truncateRunes(s string, max int) string {
 	if max <= 0 {
 		return s
@@ -94,6 +94,35 @@ func (c *Client) SendHTML(ctx context.Context, chatID int64, text string, disabl
 	return nil
 }
 
+// MaxCaptionRunes это лимит Telegram на подпись к фото
+const MaxCaptionRunes = 1024
+
+func (c *Client) SendPhoto(ctx context.Context, chatID int64, path string, caption string) error {
+	if c == nil || c.bot == nil {
+		return errors.New("searchbot botapi: client is nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if chatID == 0 {
+		return errors.New("searchbot botapi: chatID is required")
+	}
+	if strings.TrimSpace(path) == "" {
+		return errors.New("searchbot botapi: photo path is required")
+	}
+
+	msg := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(path))
+	msg.Caption = strings.TrimSpace(caption)
+	if msg.Caption != "" {
+		msg.ParseMode = "HTML"
+	}
+
+	if _, err := c.bot.Send(msg); err != nil {
+		return fmt.Errorf("searchbot botapi: send photo: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) Listen(ctx context.Context, handler func(context.Context, tgbotapi.Update) error) error {
 	if c == nil || c.bot == nil {
 		return errors.New("searchbot botapi: client is nil")
@@ -11,8 +11,15 @@ const (
 	UnknownCommand = "🤔 Не знаю такой команды.\n\nПопробуй одну из этих:\n/start\n/help\n/search &lt;текст&gt;"
 	SearchUsage    = "🔎 Просто напишите ниже, что хотите найти: название компании, фамилию или ключевое слово"
 	SearchError    = "⚠️ Не удалось выполнить поиск прямо сейчас. Попробуйте чуть позже."
+	HitNotFound    = "😕 Такой новости не нашёл."
+	HitUsage       = "🔎 Укажите номер новости: <code>/hit 123</code>"
 )
 
+// DetailLink это ссылка-команда на подробный просмотр под результатом поиска
+func DetailLink(id int64) string {
+	return fmt.Sprintf("🔎 Подробнее: /hit_%d", id)
+}
+
 func Start() string {
 	return strings.Join([]string{
 		"👋 Привет! Я бот для поиска новостей по собранной базе.",
@@ -21,6 +28,7 @@ func Start() string {
 		"• /start — приветствие",
 		"• /help — помощь",
 		"• /search — поиск по новостям",
+		"• /hit — подробно одна новость (полный текст и фото)",
 		"",
 		"",
 		"✨ Я покажу найденные новости в удобном формате.",
@@ -36,6 +44,11 @@ func Help(defaultLookback time.Duration, maxResults int) string {
 		"• /help — показать помощь",
 		"• /search — поиск по новостям",
 		"",
+		"🏷 Фильтр по ключевому слову: <code>keyword:сбер</code> или <code>kw:\"сбор данных\"</code>, можно вместе с текстом запроса.",
+		"🗂 Фильтр по группе каналов: <code>group:hr</code>.",
+		"🔗 Фильтр по ссылкам, упоминаниям и хештегам в посте: <code>domain:rbc.ru</code>, <code>mention:@durov</code>, <code>tag:#выборы</code>.",
+		"👁 Сначала самые просматриваемые: <code>sort:views</code>.",
+		"",
 		"📌 По умолчанию я ищу за последние " + defaultLookback.String() + ".",
 		fmt.Sprintf("📦 Максимум результатов за один запрос: %d.", maxResults),
 		"",
@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"time"
+	"strings"
 )
 
 type Postgres struct {
@@ -26,46 +26,137 @@ func (s *Postgres) Close() error {
 	return s.db.Close()
 }
 
-func (s *Postgres) SearchRecent(ctx context.Context, normalizedQuery string, since time.Time, limit int) ([]Hit, error) {
+// hitColumns это общий список колонок для SearchRecent и GetHit, порядок как в scanHit
+const hitColumns = `
+	h.id,
+	h.channel,
+	h.message_id,
+	h.message_date,
+	h.text,
+	h.link,
+	h.keyword,
+	h.category,
+	h.llm_reason,
+	h.llm_confidence,
+	h.classified_at,
+	COALESCE((
+		SELECT STRING_AGG(k.keyword, E'\n' ORDER BY k.first_id)
+		FROM (
+			SELECT hk.keyword, MIN(hk.id) AS first_id
+			FROM hit_keywords hk
+			WHERE hk.hit_id = h.id
+			GROUP BY hk.keyword
+		) k
+	), h.keyword) AS keywords,
+	h.channel_group,
+	h.deleted_at,
+	COALESCE(h.media_type, ''),
+	h.views,
+	h.forwards,
+	(
+		SELECT hm.path
+		FROM hit_media hm
+		WHERE hm.hit_id = h.id
+		  AND hm.kind = 'photo'
+		ORDER BY hm.id
+		LIMIT 1
+	) AS photo_path,
+	h.text_html`
+
+func (s *Postgres) SearchRecent(ctx context.Context, q SearchQuery) ([]Hit, error) {
 	if s == nil || s.db == nil {
 		return nil, errors.New("searchbot postgres storage: db is nil")
 	}
-	if normalizedQuery == "" {
-		return nil, errors.New("searchbot postgres storage: normalized query is required")
+	if q.Normalized == "" && q.Keyword == "" && q.Group == "" && q.Domain == "" && q.Mention == "" && q.Hashtag == "" {
+		return nil, errors.New("searchbot postgres storage: normalized query or a filter is required")
 	}
+	limit := q.Limit
 	if limit <= 0 {
 		limit = 10
 	}
 
+	// история (копии одной новости из разных каналов) это один результат:
+	// от нее остается самый подходящий hit
 	rows, err := s.db.QueryContext(ctx, `
-SELECT
-	id,
-	channel,
-	message_id,
-	message_date,
-	text,
-	link,
-	keyword,
-	category,
-	llm_reason,
-	llm_confidence,
-	classified_at
-FROM hits
-WHERE message_date >= $1
-  AND classified_at IS NOT NULL
-  AND category IS NOT NULL
-  AND search_text_normalized <> ''
-  AND (
-        search_text_normalized ILIKE '%' || $2 || '%'
-        OR search_text_normalized % $2
-      )
+WITH matched AS (
+	SELECT DISTINCT ON (COALESCE(h.story_id, h.id))
+		h.id,
+		CASE WHEN $6 THEN COALESCE(h.views, 0) ELSE 0 END AS by_views,
+		CASE WHEN h.search_text_normalized ILIKE '%' || $2 || '%' THEN 0 ELSE 1 END AS by_substring,
+		similarity(h.search_text_normalized, $2) AS by_similarity
+	FROM hits h
+	WHERE h.message_date >= $1
+	  AND h.classified_at IS NOT NULL
+	  AND h.category IS NOT NULL
+	  AND (
+	        $2 = ''
+	        OR (
+	            h.search_text_normalized <> ''
+	            AND (
+	                h.search_text_normalized ILIKE '%' || $2 || '%'
+	                OR h.search_text_normalized % $2
+	            )
+	        )
+	      )
+	  AND (
+	        $4 = ''
+	        OR EXISTS (
+	            SELECT 1
+	            FROM hit_keywords hk
+	            WHERE hk.hit_id = h.id
+	              AND hk.keyword ILIKE '%' || $4 || '%'
+	        )
+	      )
+	  AND ($5 = '' OR h.channel_group = $5)
+	  AND (
+	        $7 = ''
+	        OR EXISTS (
+	            SELECT 1
+	            FROM hit_entities he
+	            WHERE he.hit_id = h.id
+	              AND he.type IN ('url', 'text_url')
+	              AND (he.domain = $7 OR he.domain LIKE '%.' || $7)
+	        )
+	      )
+	  AND (
+	        $8 = ''
+	        OR EXISTS (
+	            SELECT 1
+	            FROM hit_entities he
+	            WHERE he.hit_id = h.id
+	              AND he.type = 'mention'
+	              AND he.value = $8
+	        )
+	      )
+	  AND (
+	        $9 = ''
+	        OR EXISTS (
+	            SELECT 1
+	            FROM hit_entities he
+	            WHERE he.hit_id = h.id
+	              AND he.type = 'hashtag'
+	              AND he.value = $9
+	        )
+	      )
+	ORDER BY
+		COALESCE(h.story_id, h.id),
+		by_views DESC,
+		by_substring,
+		by_similarity DESC,
+		h.message_date DESC,
+		h.id DESC
+)
+SELECT`+hitColumns+`
+FROM matched m
+JOIN hits h ON h.id = m.id
 ORDER BY
-	CASE WHEN search_text_normalized ILIKE '%' || $2 || '%' THEN 0 ELSE 1 END,
-	similarity(search_text_normalized, $2) DESC,
-	message_date DESC,
-	id DESC
+	m.by_views DESC,
+	m.by_substring,
+	m.by_similarity DESC,
+	h.message_date DESC,
+	h.id DESC
 LIMIT $3
-`, since.UTC(), normalizedQuery, limit)
+`, q.Since.UTC(), q.Normalized, limit, q.Keyword, q.Group, q.ByViews, q.Domain, q.Mention, q.Hashtag)
 	if err != nil {
 		return nil, fmt.Errorf("searchbot postgres search recent: %w", err)
 	}
@@ -73,39 +164,10 @@ LIMIT $3
 
 	out := make([]Hit, 0, limit)
 	for rows.Next() {
-		var (
-			h          Hit
-			reason     sql.NullString
-			confidence sql.NullFloat64
-		)
-
-		if err := rows.Scan(
-			&h.ID,
-			&h.Channel,
-			&h.MessageID,
-			&h.MessageDate,
-			&h.Text,
-			&h.Link,
-			&h.Keyword,
-			&h.Category,
-			&reason,
-			&confidence,
-			&h.ClassifiedAt,
-		); err != nil {
+		h, err := scanHit(rows)
+		if err != nil {
 			return nil, fmt.Errorf("searchbot postgres scan hit: %w", err)
 		}
-
-		h.MessageDate = h.MessageDate.UTC()
-		h.ClassifiedAt = h.ClassifiedAt.UTC()
-
-		if reason.Valid {
-			h.Reason = reason.String
-		}
-		if confidence.Valid {
-			v := confidence.Float64
-			h.Confidence = &v
-		}
-
 		out = append(out, h)
 	}
 
@@ -115,3 +177,112 @@ LIMIT $3
 
 	return out, nil
 }
+
+func (s *Postgres) GetHit(ctx context.Context, id int64) (Hit, bool, error) {
+	if s == nil || s.db == nil {
+		return Hit{}, false, errors.New("searchbot postgres storage: db is nil")
+	}
+	if id <= 0 {
+		return Hit{}, false, errors.New("searchbot postgres storage: id must be > 0")
+	}
+
+	row := s.db.QueryRowContext(ctx, `
+SELECT`+hitColumns+`
+FROM hits h
+WHERE h.id = $1
+  AND h.classified_at IS NOT NULL
+  AND h.category IS NOT NULL
+`, id)
+
+	h, err := scanHit(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Hit{}, false, nil
+		}
+		return Hit{}, false, fmt.Errorf("searchbot postgres get hit: %w", err)
+	}
+
+	return h, true, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanHit(row rowScanner) (Hit, error) {
+	var (
+		h          Hit
+		reason     sql.NullString
+		confidence sql.NullFloat64
+		keywords   string
+		deletedAt  sql.NullTime
+		views      sql.NullInt64
+		forwards   sql.NullInt64
+		photoPath  sql.NullString
+		textHTML   sql.NullString
+	)
+
+	if err := row.Scan(
+		&h.ID,
+		&h.Channel,
+		&h.MessageID,
+		&h.MessageDate,
+		&h.Text,
+		&h.Link,
+		&h.Keyword,
+		&h.Category,
+		&reason,
+		&confidence,
+		&h.ClassifiedAt,
+		&keywords,
+		&h.Group,
+		&deletedAt,
+		&h.MediaType,
+		&views,
+		&forwards,
+		&photoPath,
+		&textHTML,
+	); err != nil {
+		return Hit{}, err
+	}
+
+	h.MessageDate = h.MessageDate.UTC()
+	h.ClassifiedAt = h.ClassifiedAt.UTC()
+	h.Keywords = splitKeywords(keywords)
+	h.PhotoPath = photoPath.String
+	h.TextHTML = textHTML.String
+	if views.Valid {
+		v := int(views.Int64)
+		h.Views = &v
+	}
+	if forwards.Valid {
+		v := int(forwards.Int64)
+		h.Forwards = &v
+	}
+	if deletedAt.Valid {
+		t := deletedAt.Time.UTC()
+		h.DeletedAt = &t
+	}
+
+	if reason.Valid {
+		h.Reason = reason.String
+	}
+	if confidence.Valid {
+		v := confidence.Float64
+		h.Confidence = &v
+	}
+
+	return h, nil
+}
+
+func splitKeywords(s string) []string {
+	parts := strings.Split(s, "\n")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
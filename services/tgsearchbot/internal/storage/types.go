@@ -13,13 +13,47 @@ type Hit struct {
 	Text         string
 	Link         string
 	Keyword      string
+	Keywords     []string
+	Group        string
 	Category     string
 	Reason       string
 	Confidence   *float64
 	ClassifiedAt time.Time
+
+	MediaType string
+	Views     *int
+	Forwards  *int
+
+	// PhotoPath это путь к фото из hit_media, пусто если collector его не скачивал
+	PhotoPath string
+
+	// TextHTML это текст с разметкой из поста, пусто если ее нет
+	TextHTML string
+
+	// DeletedAt != nil, если collector увидел, что сообщение удалили из канала
+	DeletedAt *time.Time
+}
+
+// SearchQuery это параметры поиска
+// любой фильтр можно оставить пустым, но не все сразу
+type SearchQuery struct {
+	Normalized string
+	Keyword    string
+	Group      string
+	// Domain: ссылка в тексте на этот домен или его поддомен
+	Domain string
+	// Mention и Hashtag без @ и #, в нижнем регистре
+	Mention string
+	Hashtag string
+	// ByViews: сначала самые просматриваемые, потом уже по релевантности
+	ByViews bool
+	Since   time.Time
+	Limit   int
 }
 
 type Store interface {
-	SearchRecent(ctx context.Context, normalizedQuery string, since time.Time, limit int) ([]Hit, error)
+	SearchRecent(ctx context.Context, q SearchQuery) ([]Hit, error)
+	// GetHit отдает один классифицированный hit для подробного просмотра
+	GetHit(ctx context.Context, id int64) (Hit, bool, error)
 	Close() error
 }